@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	defaultBreakLength  = time.Duration(10 * time.Minute)
+	defaultButtonBounce = time.Duration(50 * time.Millisecond)
+)
+
+// readBreakButton Whether the break button is being pressed.
+func (si *SignInput) readBreakButton() bool {
+	if !si.breakButton.connected() {
+		return false
+	}
+	pressed, err := si.breakButton.read()
+	si.reportPinErr("button", si.breakButton.name, err)
+	return err == nil && pressed
+}
+
+// toggleBreak Starts a break when the button is pressed, or ends it early if there already is one.
+func (si *SignInput) toggleBreak(t time.Time) {
+	if si.OnBreak(t) {
+		si.endBreak(t, "button pressed")
+		return
+	}
+	if !si.breakAllowed() {
+		// Otherwise it would start by itself when the switch goes back to shifts
+		inputLog.Info("Break button ignored", "switch", si.switchValue)
+		return
+	}
+	si.breakUntil = t.Add(si.breakLength)
+	inputLog.Info("Break started", "until", si.breakUntil.Format(time.Kitchen))
+}
+
+// breakAllowed Whether the switch is in a mode a break means something in, following the shifts or forced open.
+func (si *SignInput) breakAllowed() bool {
+	return si.switchValue == stateShifts || si.switchValue == stateOpenForced
+}
+
+func (si *SignInput) endBreak(t time.Time, reason string) {
+	si.breakUntil = time.Time{}
+	inputLog.Info("Break ended", "reason", reason)
+}
+
+// expireBreak Ends the break once its time is up.
+func (si *SignInput) expireBreak(now time.Time) {
+	if !si.breakUntil.IsZero() && !now.Before(si.breakUntil) {
+		si.endBreak(now, "time's up")
+	}
+}
+
+// OnBreak Whether a mentor has stepped out. A break only means something when the switch is following the shifts or
+// forced open, in the other modes it's ignored.
+func (si *SignInput) OnBreak(t time.Time) bool {
+	return !si.breakUntil.IsZero() && t.Before(si.breakUntil) && si.breakAllowed()
+}
+
+// BreakUntil When the current break ends, zero if there isn't one.
+func (si *SignInput) BreakUntil(t time.Time) time.Time {
+	if !si.OnBreak(t) {
+		return time.Time{}
+	}
+	return si.breakUntil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestToggleBreak(t *testing.T) {
+	start := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	type step struct {
+		after       time.Duration
+		switchValue SwitchState
+		press       bool
+		wantBreak   bool
+	}
+	for _, test := range []struct {
+		name  string
+		steps []step
+	}{
+		{"press on shifts", []step{
+			{0, stateShifts, true, true},
+			{9 * time.Minute, stateShifts, false, true},
+			{10 * time.Minute, stateShifts, false, false}, // Time's up
+		}},
+		{"press again ends it", []step{
+			{0, stateShifts, true, true},
+			{time.Minute, stateShifts, true, false},
+		}},
+		{"press while forced open", []step{
+			{0, stateOpenForced, true, true},
+		}},
+		{"press while forced closed", []step{
+			{0, stateClosedForced, true, false},
+			{time.Minute, stateShifts, false, false}, // Doesn't start by itself
+		}},
+		{"press in a custom mode", []step{
+			{0, stateCustomBase, true, false},
+			{time.Minute, stateShifts, false, false},
+		}},
+		{"hidden while forced closed", []step{
+			{0, stateShifts, true, true},
+			{time.Minute, stateClosedForced, false, false},
+			{2 * time.Minute, stateShifts, false, true},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			si := &SignInput{breakLength: defaultBreakLength}
+			for _, s := range test.steps {
+				now := start.Add(s.after)
+				si.switchValue = s.switchValue
+				if s.press {
+					si.toggleBreak(now)
+				}
+				si.expireBreak(now)
+				if got := si.OnBreak(now); got != s.wantBreak {
+					t.Errorf("after %v: on break %v, want %v", s.after, got, s.wantBreak)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"time"
+)
+
+// calibrate Samples the Arduino door sensor with the door closed and then open, and writes a threshold and
+// hysteresis that separate the two into the config file.
+func calibrate(args []string) error {
+	flags := commandFlags("calibrate")
+	device := flags.String("device", "", "serial device the Arduino is on, if it isn't in the config")
+	samples := flags.Int("samples", 100, "how many readings to take with the door closed, and then open")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if *device == "" {
+		*device = config.Hardware.DoorSerial.Device
+	}
+	if *device == "" {
+		return fmt.Errorf("no device, set hardware.doorSerial.device in the config or use -device")
+	}
+	if *samples < 2 {
+		return fmt.Errorf("need at least 2 samples")
+	}
+
+	// Baud and window come from the defaults if the config doesn't have them, and get written out along with the rest.
+	serialConfig := config.Hardware.DoorSerial
+	serialConfig.Device = *device
+	sensor, err := openSerialDoorSensor(serialConfig)
+	if err != nil {
+		return err
+	}
+	defer sensor.close()
+
+	stdin := bufio.NewReader(os.Stdin)
+	fmt.Print("Close the door, then press enter...")
+	stdin.ReadString('\n')
+	closedMean, closedDev, err := sampleDoorSensor(sensor, *samples)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Closed: %.1f ± %.1f\n", closedMean, closedDev)
+
+	fmt.Print("Open the door, then press enter...")
+	stdin.ReadString('\n')
+	openMean, openDev, err := sampleDoorSensor(sensor, *samples)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Open: %.1f ± %.1f\n", openMean, openDev)
+
+	threshold, hysteresis, err := doorThreshold(closedMean, closedDev, openMean, openDev)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Threshold:", threshold, "Hysteresis:", hysteresis)
+
+	filename := configFilename()
+	if err := updateConfigFile(filename, func(c map[string]interface{}) {
+		hardware, _ := c["hardware"].(map[string]interface{})
+		if hardware == nil {
+			hardware = make(map[string]interface{})
+			c["hardware"] = hardware
+		}
+		doorSerial, _ := hardware["doorSerial"].(map[string]interface{})
+		if doorSerial == nil {
+			doorSerial = make(map[string]interface{})
+			hardware["doorSerial"] = doorSerial
+		}
+		doorSerial["device"] = *device
+		doorSerial["baud"] = serialConfig.Baud
+		doorSerial["window"] = serialConfig.Window
+		doorSerial["threshold"] = threshold
+		doorSerial["hysteresis"] = hysteresis
+	}); err != nil {
+		return err
+	}
+	fmt.Println("Saved to", filename)
+	return nil
+}
+
+// sampleDoorSensor Takes n raw readings and returns their mean and standard deviation.
+func sampleDoorSensor(sensor *serialDoorSensor, n int) (mean, stdDev float64, err error) {
+	values := make([]float64, 0, n)
+	for len(values) < n {
+		value, err := sensor.readValue()
+		if err != nil {
+			return 0, 0, err
+		}
+		values = append(values, float64(value))
+		time.Sleep(defaultSamplePeriod)
+	}
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(n)
+	for _, v := range values {
+		stdDev += (v - mean) * (v - mean)
+	}
+	stdDev = math.Sqrt(stdDev / float64(n-1))
+	return
+}
+
+// doorThreshold Puts the threshold halfway between closed and open, with enough hysteresis to cover the noise
+// while leaving a clear gap on either side.
+func doorThreshold(closedMean, closedDev, openMean, openDev float64) (threshold, hysteresis int, err error) {
+	gap := openMean - closedMean
+	if gap <= 0 {
+		return 0, 0, fmt.Errorf("the sensor reads lower with the door open than closed, check it's mounted the right way")
+	}
+	noise := 3 * math.Max(closedDev, openDev)
+	if noise >= gap/2 {
+		return 0, 0, fmt.Errorf("the readings are too noisy to tell open from closed, check the wiring")
+	}
+	threshold = int(math.Round(closedMean + gap/2))
+	hysteresis = int(math.Round(math.Min(math.Max(noise, gap/10), gap/4)))
+	return threshold, hysteresis, nil
+}
+
+// updateConfigFile Changes only the settings edit touches, and leaves the rest of the settings alone. The file is
+// written back out with its keys in alphabetical order, so the order and layout they were written in isn't kept.
+func updateConfigFile(filename string, edit func(map[string]interface{})) error {
+	c := make(map[string]interface{})
+	content, err := ioutil.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err == nil {
+		if err := json.Unmarshal(content, &c); err != nil {
+			return fmt.Errorf("%v: %v", filename, err)
+		}
+	}
+	edit(c)
+	content, err = json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	// All at once, so a crash part way through can't leave the sign with half a config
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		_, err := w.Write(append(content, '\n'))
+		return err
+	})
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+const defaultClosingSoonWindow = time.Duration(15 * time.Minute)
+
+// closingSoonWindow How long before the shifts end the sign says it's closing soon.
+func (c Config) closingSoonWindow() time.Duration {
+	if c.ClosingSoon == "" {
+		return defaultClosingSoonWindow
+	}
+	d, _ := time.ParseDuration(c.ClosingSoon) // Already validated
+	return d
+}
+
+// minutesUntilClosing Rounded up, so it never says 0 while still open.
+func (s *SignState) minutesUntilClosing() int {
+	return int(math.Ceil(s.ClosesAt.Sub(timeNow()).Minutes()))
+}
+
+// relayOn Whether the open sign above the door should be lit. It follows the phase, but can blink once a second
+// while closing soon to warn people outside too.
+func (s *SignState) relayOn() bool {
+	if s.Phase == phaseClosingSoon && config.ClosingSoonBlink {
+		return timeNow().Nanosecond() < int(time.Second/2)
+	}
+	return s.phaseOpen()
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// command is something the sign binary can do, picked by the first argument. Without one it runs the sign.
+type command struct {
+	name    string
+	run     func(args []string) error
+	summary string
+}
+
+var commands = []command{
+	{"run", runSign, "run the sign (the default)"},
+	{"supervise", supervise, "run the sign, restarting it if it crashes or hangs"},
+	{"safe", safeDisplay, "show that the sign is down, without reading any inputs"},
+	{"validate", validate, "check the config file and exit"},
+	{"config", configCommand, "print the config with the environment and -set applied (config print)"},
+	{"simulate", simulate, "play a script of inputs through the sign and print what it says"},
+	{"render", render, "show what the sign looks like for some inputs in a window"},
+	{"replay", replay, "play a recording of the inputs back in a window"},
+	{"report", report, "summarize the activity log"},
+	{"status", status, "show the inputs of a running sign"},
+	{"calibrate", calibrate, "calibrate the Arduino door sensor"},
+}
+
+// configPath is the config file from -config, which beats CONFIG.
+var configPath string
+
+// commandFlags Starts the flags for a command, with the -config and -set flags they all share.
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "config file, instead of CONFIG or config.json")
+	flags.Var(&configSettings, "set", "change a setting from the config file, like display.width=1280 (repeatable)")
+	return flags
+}
+
+// parseCommandFlags Parses the flags for a command and then loads the config, so -config is taken into account.
+func parseCommandFlags(flags *flag.FlagSet, args []string) error {
+	flags.Parse(args)
+	c, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	config = c
+	if err := setupLogging(config.Logging); err != nil {
+		return fmt.Errorf("logging: %v", err)
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Println("Usage: studio_status_go [command] [flags]")
+	fmt.Println()
+	for _, c := range commands {
+		fmt.Printf("  %-10v %v\n", c.name, c.summary)
+	}
+	fmt.Println()
+	fmt.Println("Use studio_status_go <command> -h for a command's flags.")
+}
+
+func validate(args []string) error {
+	flags := commandFlags("validate")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	fmt.Println(configFilename(), "is valid")
+	return nil
+}
+
+// status Asks a running sign for its inputs, as served at /debug/inputs.
+func status(args []string) error {
+	flags := commandFlags("status")
+	addr := flags.String("addr", "", "host:port the sign is serving on, the server.address from the config if empty")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if *addr == "" {
+		_, port, _ := net.SplitHostPort(config.Server.Address)
+		*addr = net.JoinHostPort("localhost", port)
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get("http://" + *addr + "/debug/inputs")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		return err
+	}
+	fmt.Println(indented.String())
+	return nil
+}
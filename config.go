@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is read from config.json (or wherever CONFIG points) at startup. Anything left out keeps its default.
+type Config struct {
+	Hardware HardwareConfig     `json:"hardware"`
+	Capacity int                `json:"capacity"` // Most people allowed in the studio, 0 for no limit
+	Nodes    []RemoteNodeConfig `json:"nodes"`    // Sensor boards that send readings over the network
+	Modes    []ModeConfig       `json:"modes"`    // Extra switch positions, for the rotary switch
+	// How long a break from the break button lasts, "10m" if empty
+	BreakLength string `json:"breakLength"`
+	// How long before the last shift of the day ends to warn that the studio is closing, "15m" if empty, "0s" never
+	ClosingSoon string `json:"closingSoon"`
+	// Blink the open sign above the door while closing soon
+	ClosingSoonBlink bool `json:"closingSoonBlink"`
+
+	Inputs       InputsConfig     `json:"inputs"`
+	Display      DisplayConfig    `json:"display"`
+	Server       ServerConfig     `json:"server"`
+	Post         PostConfig       `json:"post"`
+	Logging      LoggingConfig    `json:"logging"`
+	Supervisor   SupervisorConfig `json:"supervisor"`
+	LogFile      string           `json:"logFile"`      // The activity log, for the statistics
+	RecordInputs string           `json:"recordInputs"` // Where to record the inputs for replaying, nowhere if empty
+	StateFile    string           `json:"stateFile"`    // Keeps breaks, overrides and the count over restarts
+	Dev          bool             `json:"dev"`          // Don't log or post, and only serve on localhost
+}
+
+// InputsConfig is how the inputs are sampled and filtered. The durations are like "500ms" or "5s".
+type InputsConfig struct {
+	SamplePeriod   string `json:"samplePeriod"`   // How often the pins are read
+	DoorDebounce   string `json:"doorDebounce"`   // How long the door has to stay put to count
+	SwitchDebounce string `json:"switchDebounce"` // How long the switch has to stay put to count
+	OpenHold       string `json:"openHold"`       // How long the sign stays open or closed before it can change back
+	OccupancyTime  string `json:"occupancyTime"`  // How long after the last motion the studio counts as occupied
+	DoorStuckTime  string `json:"doorStuckTime"`  // How long the door can stay put before it's a fault, "0s" never
+}
+
+// DisplayConfig is the screen the sign is drawn on.
+type DisplayConfig struct {
+	Width          int    `json:"width"`
+	Height         int    `json:"height"`
+	TicksPerSecond int    `json:"ticksPerSecond"` // How often the sign is updated and redrawn
+	Headless       bool   `json:"headless"`       // Draw in memory instead of a window, for servers and CI
+	SnapshotFile   string `json:"snapshotFile"`   // A PNG of the sign, rewritten every snapshotPeriod, none if empty
+	SnapshotPeriod string `json:"snapshotPeriod"`
+}
+
+// LoggingConfig is where the sign's own messages go. The activity log is logFile.
+type LoggingConfig struct {
+	Level        string `json:"level"`        // debug, info, warn or error
+	Output       string `json:"output"`       // console, file or journald
+	File         string `json:"file"`         // For the file output
+	RepeatWindow string `json:"repeatWindow"` // The same warning or error is only logged once this often, "0s" always
+}
+
+// SupervisorConfig is how supervise looks after the sign.
+type SupervisorConfig struct {
+	CrashDir        string `json:"crashDir"`    // Where crash reports go
+	CrashLines      int    `json:"crashLines"`  // How much of what the sign printed goes in a crash report
+	MaxBackoff      string `json:"maxBackoff"`  // The longest wait before restarting after a crash
+	HangTimeout     string `json:"hangTimeout"` // How long the sign can go without a heartbeat before it's killed
+	CrashLoop       int    `json:"crashLoop"`   // This many crashes within crashLoopWindow shows the safe display
+	CrashLoopWindow string `json:"crashLoopWindow"`
+	SafeModeTime    string `json:"safeModeTime"` // How long the safe display is shown before trying again
+}
+
+// ServerConfig is the HTTP server for /debug, /override and /sensors. It's plain HTTP with pprof on it, so it
+// shouldn't be reachable from outside the studio's network.
+type ServerConfig struct {
+	Address         string `json:"address"`         // host:port, only localhost is used in dev
+	OverrideKey     string `json:"overrideKey"`     // Needed as x-api-key for /override, which is off without one
+	OverrideKeyFile string `json:"overrideKeyFile"` // Read into overrideKey
+}
+
+// PostConfig is where the sign's status and statistics are sent. Secrets can be kept out of the config file by
+// putting them in a file of their own.
+type PostConfig struct {
+	URL        string `json:"url"`        // Gets the status every second
+	StatsURL   string `json:"statsURL"`   // Gets the statistics graph
+	APIKey     string `json:"apiKey"`     // Sent as x-api-key
+	APIKeyFile string `json:"apiKeyFile"` // Read into apiKey
+	Format     string `json:"format"`     // "legacy" for what was always posted, or "v2", see statusPayload
+	Timeout    string `json:"timeout"`    // How long a post can take
+	MaxBackoff string `json:"maxBackoff"` // The longest wait before trying again while posts are failing
+	QueueFile  string `json:"queueFile"`  // Where v2 transitions are kept until they're posted, memory only if empty
+	QueueSize  int    `json:"queueSize"`  // Most transitions kept, the oldest are dropped past this
+}
+
+// ModeConfig is a switch position beyond shifts, forced open and forced closed, e.g. "Private Event".
+type ModeConfig struct {
+	Name     string `json:"name"`  // What the rotary switch config and remote nodes call it
+	Title    string `json:"title"` // Shown instead of Open or Closed
+	Subtitle string `json:"subtitle"`
+	Color    string `json:"color"` // Background, see modeColors
+	Open     bool   `json:"open"`  // Whether the studio counts as open (while the door is)
+}
+
+// RemoteNodeConfig is a sensor board on the network. The sensors it provides are used instead of any pins for them.
+type RemoteNodeConfig struct {
+	Name    string   `json:"name"`
+	Key     string   `json:"key"`     // Sent by the node as x-api-key
+	KeyFile string   `json:"keyFile"` // Read into key
+	Sensors []string `json:"sensors"` // Any of door, switch and motion
+	Timeout string   `json:"timeout"` // How long it can go without posting before it's a fault, "30s" if empty
+}
+
+// HardwareConfig describes how the switch, sensors and relay are wired to the Pi.
+type HardwareConfig struct {
+	SwitchShifts PinConfig    `json:"switchShifts"` // Active when the DPDT switch is in I (normal)
+	SwitchOpen   PinConfig    `json:"switchOpen"`   // Active when the DPDT switch is in II (force open)
+	Door         PinConfig    `json:"door"`         // Active when the door is open
+	DoorSerial   SerialConfig `json:"doorSerial"`   // The Arduino analog door sensor, used instead of door if set
+	Motion       PinConfig    `json:"motion"`       // Active when the PIR sensor sees motion
+	OuterBeam    PinConfig    `json:"outerBeam"`    // Active while the break-beam outside the door is broken
+	InnerBeam    PinConfig    `json:"innerBeam"`    // Active while the break-beam inside the door is broken
+	BreakButton  PinConfig    `json:"breakButton"`  // Active while the "back soon" button is pressed
+	Relay        PinConfig    `json:"relay"`        // Active turns on the open sign above the door
+	Rotary       RotaryConfig `json:"rotary"`       // Used instead of switchShifts and switchOpen if it has pins
+}
+
+// RotaryConfig is a multi-position switch read as a binary code over several pins.
+type RotaryConfig struct {
+	Pins      []PinConfig      `json:"pins"` // Lowest bit first
+	Positions []RotaryPosition `json:"positions"`
+}
+
+// RotaryPosition maps the code for one position of the rotary switch to a mode, either shifts, open, closed or
+// one from modes.
+type RotaryPosition struct {
+	Code int    `json:"code"`
+	Mode string `json:"mode"`
+}
+
+// SerialConfig is a sensor on a serial port, like the Arduino door sensor. An empty device means there isn't one.
+type SerialConfig struct {
+	Device     string `json:"device"` // e.g. "/dev/ttyACM0"
+	Baud       int    `json:"baud"`
+	Threshold  int    `json:"threshold"`  // Readings averaging above this mean open
+	Hysteresis int    `json:"hysteresis"` // How far past the threshold the average has to go to change state
+	Window     int    `json:"window"`     // How many readings are averaged
+}
+
+// PinConfig is a single GPIO pin. Pins are named the way hwio names them, i.e. BCM numbering like "gpio17".
+// An empty pin means nothing is connected.
+type PinConfig struct {
+	Pin       string `json:"pin"`
+	ActiveLow bool   `json:"activeLow"` // LOW means active instead of HIGH
+	Pull      string `json:"pull"`      // "up", "down", or "" to leave the pin floating
+}
+
+const defaultConfigFilename = "config.json"
+
+func defaultConfig() Config {
+	return Config{
+		Hardware: HardwareConfig{
+			SwitchShifts: PinConfig{Pin: "gpio17"},
+			SwitchOpen:   PinConfig{Pin: "gpio27"},
+			// The reed switch outputs LOW when the door is open.
+			Door:       PinConfig{Pin: "gpio18", ActiveLow: true},
+			DoorSerial: SerialConfig{Baud: 9600, Window: 10},
+			Motion:     PinConfig{},
+			OuterBeam:  PinConfig{},
+			InnerBeam:  PinConfig{},
+			Relay:      PinConfig{Pin: "gpio22"},
+		},
+		BreakLength: defaultBreakLength.String(),
+		ClosingSoon: defaultClosingSoonWindow.String(),
+		Inputs: InputsConfig{
+			SamplePeriod:   defaultSamplePeriod.String(),
+			DoorDebounce:   defaultDoorDebounce.String(),
+			SwitchDebounce: defaultSwitchDebounce.String(),
+			OpenHold:       defaultOpenHold.String(),
+			OccupancyTime:  defaultOccupancyTime.String(),
+			DoorStuckTime:  defaultDoorStuckTime.String(),
+		},
+		Display: DisplayConfig{Width: 1920, Height: 1080, TicksPerSecond: 22, SnapshotPeriod: "1m0s"},
+		Server:  ServerConfig{Address: "0.0.0.0:6060"},
+		Post: PostConfig{
+			URL:        "https://ds-sign.yunyul.in",
+			StatsURL:   "http://spuri.io/studio-statistics.png",
+			Format:     "legacy", // What the server takes today, which means no transitions are queued
+			Timeout:    "10s",
+			MaxBackoff: "5m0s",
+			QueueFile:  "post-queue.jsonl",
+			QueueSize:  1000,
+		},
+		Logging: LoggingConfig{Level: "info", Output: "console", File: "sign.log", RepeatWindow: "1m0s"},
+		Supervisor: SupervisorConfig{
+			CrashDir:        "crashes",
+			CrashLines:      200,
+			MaxBackoff:      "1m0s",
+			HangTimeout:     "30s",
+			CrashLoop:       5,
+			CrashLoopWindow: "10m0s",
+			SafeModeTime:    "10m0s",
+		},
+		LogFile:   "activity.log",
+		StateFile: "state.json",
+	}
+}
+
+var config = defaultConfig()
+
+// loadConfig Reads the config file over the defaults, then applies the environment variables and -set flags, and
+// reads any secrets from their files. A missing file is fine, an invalid one is not.
+func loadConfig() (Config, error) {
+	c := defaultConfig()
+	if err := c.readFile(configFilename()); err != nil {
+		return c, err
+	}
+	if err := c.applyEnv(); err != nil {
+		return c, err
+	}
+	for _, setting := range configSettings {
+		if err := c.set(setting); err != nil {
+			return c, fmt.Errorf("-set %v: %v", setting, err)
+		}
+	}
+	if err := c.readSecrets(); err != nil {
+		return c, err
+	}
+	return c, c.validate()
+}
+
+func (c *Config) readFile(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) && filename == defaultConfigFilename {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(c); err != nil {
+		return fmt.Errorf("%v: %v", filename, err)
+	}
+	return nil
+}
+
+func configFilename() string {
+	if configPath != "" {
+		return configPath
+	}
+	if filename := os.Getenv("CONFIG"); filename != "" {
+		return filename
+	}
+	return defaultConfigFilename
+}
+
+func (c Config) validate() error {
+	if c.Capacity < 0 {
+		return fmt.Errorf("capacity can't be negative")
+	}
+	if c.Capacity > 0 && c.Hardware.OuterBeam.Pin == "" {
+		return fmt.Errorf("capacity needs the break-beams in hardware.outerBeam and hardware.innerBeam to count people")
+	}
+	if err := validateRemoteNodes(c.Nodes); err != nil {
+		return err
+	}
+	if c.BreakLength != "" {
+		if d, err := time.ParseDuration(c.BreakLength); err != nil || d <= 0 {
+			return fmt.Errorf("breakLength should be a duration like \"10m\"")
+		}
+	}
+	if c.ClosingSoon != "" {
+		if d, err := time.ParseDuration(c.ClosingSoon); err != nil || d < 0 {
+			return fmt.Errorf("closingSoon should be a duration like \"15m\"")
+		}
+	}
+	if err := c.Inputs.validate(); err != nil {
+		return err
+	}
+	if c.Display.Width <= 0 || c.Display.Height <= 0 {
+		return fmt.Errorf("display: width and height have to be more than 0")
+	}
+	if c.Display.TicksPerSecond < 1 || c.Display.TicksPerSecond > 100 {
+		return fmt.Errorf("display.ticksPerSecond should be between 1 and 100")
+	}
+	if d, err := time.ParseDuration(c.Display.SnapshotPeriod); err != nil || d <= 0 {
+		return fmt.Errorf("display.snapshotPeriod should be a duration like \"1m\"")
+	}
+	if _, _, err := net.SplitHostPort(c.Server.Address); err != nil {
+		return fmt.Errorf("server.address should be like \"0.0.0.0:6060\"")
+	}
+	if err := validateURL("post.url", c.Post.URL); err != nil {
+		return err
+	}
+	if err := validateURL("post.statsURL", c.Post.StatsURL); err != nil {
+		return err
+	}
+	if c.Post.Format != "legacy" && c.Post.Format != "v2" {
+		return fmt.Errorf("post.format should be legacy or v2")
+	}
+	if d, err := time.ParseDuration(c.Post.Timeout); err != nil || d <= 0 {
+		return fmt.Errorf("post.timeout should be a duration like \"10s\"")
+	}
+	if d, err := time.ParseDuration(c.Post.MaxBackoff); err != nil || d <= 0 {
+		return fmt.Errorf("post.maxBackoff should be a duration like \"5m\"")
+	}
+	if c.Post.QueueSize < 1 {
+		return fmt.Errorf("post.queueSize has to be at least 1")
+	}
+	if c.LogFile == "" {
+		return fmt.Errorf("logFile can't be empty")
+	}
+	if err := c.Logging.validate(); err != nil {
+		return err
+	}
+	if err := c.Supervisor.validate(); err != nil {
+		return err
+	}
+	if err := validateModes(c.Modes); err != nil {
+		return err
+	}
+	if err := validateRotary(c.Hardware.Rotary, c.Modes); err != nil {
+		return err
+	}
+	return c.Hardware.validate()
+}
+
+func (l LoggingConfig) validate() error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return fmt.Errorf("logging.level should be debug, info, warn or error")
+	}
+	switch l.Output {
+	case "console", "journald":
+	case "file":
+		if l.File == "" {
+			return fmt.Errorf("logging.file can't be empty with the file output")
+		}
+	default:
+		return fmt.Errorf("logging.output should be console, file or journald")
+	}
+	if d, err := time.ParseDuration(l.RepeatWindow); err != nil || d < 0 {
+		return fmt.Errorf("logging.repeatWindow should be a duration like \"1m\"")
+	}
+	return nil
+}
+
+func (s SupervisorConfig) validate() error {
+	if s.CrashDir == "" {
+		return fmt.Errorf("supervisor.crashDir can't be empty")
+	}
+	if s.CrashLines < 1 {
+		return fmt.Errorf("supervisor.crashLines has to be at least 1")
+	}
+	if s.CrashLoop < 1 {
+		return fmt.Errorf("supervisor.crashLoop has to be at least 1")
+	}
+	for _, d := range []struct{ name, value string }{
+		{"maxBackoff", s.MaxBackoff},
+		{"hangTimeout", s.HangTimeout},
+		{"crashLoopWindow", s.CrashLoopWindow},
+		{"safeModeTime", s.SafeModeTime},
+	} {
+		if parsed, err := time.ParseDuration(d.value); err != nil || parsed <= 0 {
+			return fmt.Errorf("supervisor.%v should be a duration like \"1m\"", d.name)
+		}
+	}
+	return nil
+}
+
+func (h HardwareConfig) validate() error {
+	type namedPin struct {
+		name   string
+		pin    PinConfig
+		output bool
+	}
+	pins := []namedPin{
+		{"door", h.Door, false},
+		{"motion", h.Motion, false},
+		{"outerBeam", h.OuterBeam, false},
+		{"innerBeam", h.InnerBeam, false},
+		{"breakButton", h.BreakButton, false},
+		{"relay", h.Relay, true},
+	}
+	if len(h.Rotary.Pins) > 0 {
+		for i, pin := range h.Rotary.Pins {
+			pins = append(pins, namedPin{fmt.Sprintf("rotary.pins[%v]", i), pin, false})
+		}
+	} else {
+		pins = append(pins, namedPin{"switchShifts", h.SwitchShifts, false}, namedPin{"switchOpen", h.SwitchOpen, false})
+	}
+	usedBy := make(map[string]string)
+	for _, p := range pins {
+		if p.pin.Pin == "" {
+			if strings.HasPrefix(p.name, "rotary") {
+				return fmt.Errorf("hardware.%v: needs a pin", p.name)
+			}
+			continue
+		}
+		if !strings.HasPrefix(p.pin.Pin, "gpio") {
+			return fmt.Errorf("hardware.%v: pin %q should be a BCM name like \"gpio17\"", p.name, p.pin.Pin)
+		}
+		if other, ok := usedBy[p.pin.Pin]; ok {
+			return fmt.Errorf("hardware.%v: pin %v is already used by %v", p.name, p.pin.Pin, other)
+		}
+		usedBy[p.pin.Pin] = p.name
+		switch p.pin.Pull {
+		case "", "up", "down":
+		default:
+			return fmt.Errorf("hardware.%v: pull should be \"up\", \"down\" or empty, not %q", p.name, p.pin.Pull)
+		}
+		if p.output && p.pin.Pull != "" {
+			return fmt.Errorf("hardware.%v: outputs can't have a pull", p.name)
+		}
+	}
+	// The switch needs both of its pins, or neither.
+	if (h.SwitchShifts.Pin == "") != (h.SwitchOpen.Pin == "") {
+		return fmt.Errorf("hardware: switchShifts and switchOpen must both be set or both be empty")
+	}
+	if err := validateSerialConfig("doorSerial", h.DoorSerial); err != nil {
+		return err
+	}
+	if (h.OuterBeam.Pin == "") != (h.InnerBeam.Pin == "") {
+		return fmt.Errorf("hardware: outerBeam and innerBeam must both be set or both be empty")
+	}
+	return nil
+}
+
+func (ic InputsConfig) validate() error {
+	durations := []struct {
+		name, value string
+		min         time.Duration
+	}{
+		{"samplePeriod", ic.SamplePeriod, time.Millisecond},
+		{"doorDebounce", ic.DoorDebounce, 0},
+		{"switchDebounce", ic.SwitchDebounce, 0},
+		{"openHold", ic.OpenHold, 0},
+		{"occupancyTime", ic.OccupancyTime, 0},
+		{"doorStuckTime", ic.DoorStuckTime, 0},
+	}
+	for _, d := range durations {
+		if parsed, err := time.ParseDuration(d.value); err != nil || parsed < d.min {
+			if d.min > 0 {
+				return fmt.Errorf("inputs.%v should be a duration like \"500ms\", of at least %v", d.name, d.min)
+			}
+			return fmt.Errorf("inputs.%v should be a duration like \"500ms\"", d.name)
+		}
+	}
+	return nil
+}
+
+func validateURL(name, value string) error {
+	if value == "" {
+		return nil
+	}
+	if u, err := url.Parse(value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%v should be an http or https URL", name)
+	}
+	return nil
+}
+
+// duration A duration from the config, which has already been validated.
+func duration(value string) time.Duration {
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// tick How long each tick of the state machine is.
+func (c Config) tick() time.Duration {
+	return time.Second / time.Duration(c.Display.TicksPerSecond)
+}
+
+// serverAddress Where the HTTP server listens, only on localhost in dev.
+func (c Config) serverAddress() string {
+	if c.Dev {
+		_, port, _ := net.SplitHostPort(c.Server.Address)
+		return net.JoinHostPort("localhost", port)
+	}
+	return c.Server.Address
+}
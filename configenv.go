@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// configEnv are the environment variables that still work from before everything was in the config file. They beat
+// the file, and -set beats them.
+var configEnv = []struct {
+	name, path string
+	flag       bool // Set to true by any value
+}{
+	{"DEV", "dev", true},
+	{"x_api_key", "post.apiKey", false},
+	{"RECORD_INPUTS", "recordInputs", false},
+	{"INPUT_SAMPLE_PERIOD", "inputs.samplePeriod", false},
+	{"DOOR_DEBOUNCE", "inputs.doorDebounce", false},
+	{"SWITCH_DEBOUNCE", "inputs.switchDebounce", false},
+	{"OPEN_HOLD", "inputs.openHold", false},
+	{"OCCUPANCY_TIME", "inputs.occupancyTime", false},
+	{"DOOR_STUCK_TIME", "inputs.doorStuckTime", false},
+}
+
+// configSettings are the -set flags, like "display.width=1280".
+var configSettings settingsFlag
+
+type settingsFlag []string
+
+func (sf *settingsFlag) String() string {
+	return strings.Join(*sf, " ")
+}
+
+func (sf *settingsFlag) Set(setting string) error {
+	if !strings.Contains(setting, "=") {
+		return fmt.Errorf("should be like path.to.setting=value")
+	}
+	*sf = append(*sf, setting)
+	return nil
+}
+
+func (c *Config) applyEnv() error {
+	for _, env := range configEnv {
+		value := os.Getenv(env.name)
+		if value == "" {
+			continue
+		}
+		if env.flag {
+			value = "true"
+		}
+		if err := c.set(env.path + "=" + value); err != nil {
+			return fmt.Errorf("%v: %v", env.name, err)
+		}
+	}
+	return nil
+}
+
+// set Changes one setting, given as "path.to.setting=value" with the names from the config file. The value is
+// JSON, or a string if it isn't valid JSON, so "door.pin=gpio5" works without the quotes.
+func (c *Config) set(setting string) error {
+	parts := strings.SplitN(setting, "=", 2)
+	path, value := strings.Split(parts[0], "."), parts[1]
+
+	content, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(content, &m); err != nil {
+		return err
+	}
+	node := m
+	for _, key := range path[:len(path)-1] {
+		child, ok := node[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("there's no setting called %v", parts[0])
+		}
+		node = child
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(value), &v); err != nil {
+		v = value
+	}
+	err = c.decodeWith(m, path[len(path)-1], node, v)
+	if _, isString := v.(string); err != nil && !isString {
+		// Like DOOR_STUCK_TIME=0, which looks like a number but is a duration
+		err = c.decodeWith(m, path[len(path)-1], node, value)
+	}
+	return err
+}
+
+// decodeWith Puts v in node under key, and then decodes all of m into the config.
+func (c *Config) decodeWith(m map[string]interface{}, key string, node map[string]interface{}, v interface{}) error {
+	node[key] = v
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	var updated Config
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&updated); err != nil {
+		return err
+	}
+	*c = updated
+	return nil
+}
+
+// readSecrets Reads the secrets that are kept in files of their own, so they don't have to be in the config file
+// or the environment.
+func (c *Config) readSecrets() error {
+	if err := readSecret(&c.Post.APIKey, c.Post.APIKeyFile, "post.apiKey"); err != nil {
+		return err
+	}
+	if err := readSecret(&c.Server.OverrideKey, c.Server.OverrideKeyFile, "server.overrideKey"); err != nil {
+		return err
+	}
+	for i := range c.Nodes {
+		if err := readSecret(&c.Nodes[i].Key, c.Nodes[i].KeyFile, fmt.Sprintf("nodes[%v].key", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readSecret(secret *string, filename, name string) error {
+	if filename == "" {
+		return nil
+	}
+	if *secret != "" {
+		return fmt.Errorf("%v is set, and so is %vFile", name, name)
+	}
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("%vFile: %v", name, err)
+	}
+	*secret = strings.TrimSpace(string(content))
+	return nil
+}
+
+// redacted A copy of the config that's safe to print.
+func (c Config) redacted() Config {
+	const hidden = "(hidden)"
+	if c.Post.APIKey != "" {
+		c.Post.APIKey = hidden
+	}
+	if c.Server.OverrideKey != "" {
+		c.Server.OverrideKey = hidden
+	}
+	nodes := make([]RemoteNodeConfig, len(c.Nodes))
+	for i, node := range c.Nodes {
+		if node.Key != "" {
+			node.Key = hidden
+		}
+		nodes[i] = node
+	}
+	c.Nodes = nodes
+	return c
+}
+
+// configCommand "config print" Prints the config the sign would run with, after the defaults, the file, the
+// environment and -set, with the secrets hidden.
+func configCommand(args []string) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print [-config file] [-set path=value]")
+	}
+	flags := commandFlags("config print")
+	if err := parseCommandFlags(flags, args[1:]); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(config.redacted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
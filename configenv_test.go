@@ -0,0 +1,127 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string // Empty if it's valid
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"negative capacity", func(c *Config) { c.Capacity = -1 }, "capacity can't be negative"},
+		{"capacity without beams", func(c *Config) { c.Capacity = 10 }, "capacity needs the break-beams"},
+		{"capacity with beams", func(c *Config) {
+			c.Capacity = 10
+			c.Hardware.OuterBeam.Pin, c.Hardware.InnerBeam.Pin = "gpio5", "gpio6"
+		}, ""},
+		{"only one beam", func(c *Config) { c.Hardware.OuterBeam.Pin = "gpio5" }, "outerBeam and innerBeam must both be set"},
+		{"break length", func(c *Config) { c.BreakLength = "10" }, "breakLength should be a duration"},
+		{"closing soon never", func(c *Config) { c.ClosingSoon = "0s" }, ""},
+		{"sample period too short", func(c *Config) { c.Inputs.SamplePeriod = "0s" }, "inputs.samplePeriod should be a duration"},
+		{"no door stuck check", func(c *Config) { c.Inputs.DoorStuckTime = "0s" }, ""},
+		{"no display", func(c *Config) { c.Display.Width = 0 }, "display: width and height"},
+		{"ticks per second", func(c *Config) { c.Display.TicksPerSecond = 0 }, "display.ticksPerSecond"},
+		{"server address", func(c *Config) { c.Server.Address = "6060" }, "server.address"},
+		{"post url", func(c *Config) { c.Post.URL = "ds-sign.yunyul.in" }, "post.url should be an http or https URL"},
+		{"no post url", func(c *Config) { c.Post.URL = "" }, ""},
+		{"post format", func(c *Config) { c.Post.Format = "v3" }, "post.format"},
+		{"queue size", func(c *Config) { c.Post.QueueSize = 0 }, "post.queueSize"},
+		{"no log file", func(c *Config) { c.LogFile = "" }, "logFile can't be empty"},
+		{"logging level", func(c *Config) { c.Logging.Level = "loud" }, "logging.level"},
+		{"file logging without a file", func(c *Config) { c.Logging.Output, c.Logging.File = "file", "" }, "logging.file"},
+		{"crash loop", func(c *Config) { c.Supervisor.CrashLoop = 0 }, "supervisor.crashLoop"},
+		{"hang timeout", func(c *Config) { c.Supervisor.HangTimeout = "0s" }, "supervisor.hangTimeout"},
+		{"pin name", func(c *Config) { c.Hardware.Door.Pin = "18" }, "hardware.door: pin \"18\" should be a BCM name"},
+		{"pin used twice", func(c *Config) { c.Hardware.Motion.Pin = "gpio18" }, "hardware.motion: pin gpio18 is already used by door"},
+		{"pull", func(c *Config) { c.Hardware.Door.Pull = "sideways" }, "hardware.door: pull should be"},
+		{"pull on an output", func(c *Config) { c.Hardware.Relay.Pull = "up" }, "hardware.relay: outputs can't have a pull"},
+		{"half a switch", func(c *Config) { c.Hardware.SwitchOpen.Pin = "" }, "switchShifts and switchOpen must both be set"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c := defaultConfig()
+			test.change(&c)
+			err := c.validate()
+			if test.wantErr == "" && err != nil {
+				t.Errorf("got %v, want it to be valid", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSet(t *testing.T) {
+	for _, test := range []struct {
+		setting string
+		check   func(c Config) bool
+		wantErr string
+	}{
+		{"display.width=1280", func(c Config) bool { return c.Display.Width == 1280 }, ""},
+		{"hardware.door.pin=gpio5", func(c Config) bool { return c.Hardware.Door.Pin == "gpio5" }, ""},
+		{`hardware.door.pin="gpio5"`, func(c Config) bool { return c.Hardware.Door.Pin == "gpio5" }, ""},
+		{"hardware.door.activeLow=false", func(c Config) bool { return !c.Hardware.Door.ActiveLow }, ""},
+		{"dev=true", func(c Config) bool { return c.Dev }, ""},
+		{"inputs.doorStuckTime=0", func(c Config) bool { return c.Inputs.DoorStuckTime == "0" }, ""},
+		{`modes=[{"name": "event", "title": "Event", "color": "blue"}]`, func(c Config) bool {
+			return len(c.Modes) == 1 && c.Modes[0].Title == "Event"
+		}, ""},
+		{"logging.output=", func(c Config) bool { return c.Logging.Output == "" }, ""},
+		{"display.width=wide", nil, "cannot unmarshal"},
+		{"display.depth=24", nil, "unknown field"},
+		{"screen.width=1280", nil, "there's no setting called screen.width"},
+		{"display.width.pixels=1280", nil, "there's no setting called display.width.pixels"},
+	} {
+		c := defaultConfig()
+		err := c.set(test.setting)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%v: got %v, want %q", test.setting, err, test.wantErr)
+			}
+			if err == nil || c.Display.Width != defaultConfig().Display.Width {
+				t.Errorf("%v: changed the config anyway", test.setting)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.setting, err)
+		} else if !test.check(c) {
+			t.Errorf("%v: not set, got %+v", test.setting, c)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		env   map[string]string
+		check func(c Config) bool
+	}{
+		{"nothing set", nil, func(c Config) bool { return !c.Dev && c.Post.APIKey == "" }},
+		{"DEV is a flag", map[string]string{"DEV": "0"}, func(c Config) bool { return c.Dev }},
+		{"api key", map[string]string{"x_api_key": "12345"}, func(c Config) bool { return c.Post.APIKey == "12345" }},
+		{"durations", map[string]string{"INPUT_SAMPLE_PERIOD": "20ms", "DOOR_STUCK_TIME": "0"}, func(c Config) bool {
+			return c.Inputs.SamplePeriod == "20ms" && c.Inputs.DoorStuckTime == "0"
+		}},
+		// Checking it's a duration is left to validate
+		{"not a duration", map[string]string{"OPEN_HOLD": "soon"}, func(c Config) bool {
+			return c.Inputs.OpenHold == "soon" && c.validate() != nil
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, env := range configEnv {
+				t.Setenv(env.name, test.env[env.name])
+			}
+			c := defaultConfig()
+			if err := c.applyEnv(); err != nil {
+				t.Fatal(err)
+			}
+			if !test.check(c) {
+				t.Errorf("not applied, got %+v", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+)
+
+const (
+	contactSheetColumns = 4
+	contactSheetShrink  = 4 // Each picture is this many times smaller than the screen
+	contactSheetGap     = 8
+	// More than this and the sheet gets too big to look at, so the rest are left off.
+	maxContactSheetFrames = 200
+)
+
+// contactSheet collects small pictures of the sign, to be laid out in a grid in the order they were taken.
+type contactSheet struct {
+	frames  []*image.RGBA
+	skipped int
+}
+
+// add Takes a picture of what the sign has just composed, which has to be before it's presented.
+func (cs *contactSheet) add(s *SignState) error {
+	if len(cs.frames) >= maxContactSheetFrames {
+		cs.skipped++
+		return nil
+	}
+	img, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	cs.frames = append(cs.frames, shrink(img, contactSheetShrink))
+	return nil
+}
+
+// write Saves the sheet as a PNG, left to right and then top to bottom.
+func (cs *contactSheet) write(filename string) error {
+	if len(cs.frames) == 0 {
+		return fmt.Errorf("nothing to put on the contact sheet")
+	}
+	if cs.skipped > 0 {
+		displayLog.Warn("Contact sheet is full", "saved", len(cs.frames), "skipped", cs.skipped)
+	}
+	frame := cs.frames[0].Bounds().Size()
+	columns := contactSheetColumns
+	if len(cs.frames) < columns {
+		columns = len(cs.frames)
+	}
+	rows := (len(cs.frames) + columns - 1) / columns
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		columns*(frame.X+contactSheetGap)+contactSheetGap,
+		rows*(frame.Y+contactSheetGap)+contactSheetGap))
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Gray{0x40}), image.Point{}, draw.Src)
+	for i, f := range cs.frames {
+		x := contactSheetGap + (i%columns)*(frame.X+contactSheetGap)
+		y := contactSheetGap + (i/columns)*(frame.Y+contactSheetGap)
+		draw.Draw(sheet, image.Rect(x, y, x+frame.X, y+frame.Y), f, image.Point{}, draw.Src)
+	}
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		return png.Encode(w, sheet)
+	})
+}
+
+// shrink Makes img factor times smaller by averaging each factor by factor square of pixels.
+func shrink(img *image.RGBA, factor int) *image.RGBA {
+	size := img.Bounds().Size()
+	small := image.NewRGBA(image.Rect(0, 0, size.X/factor, size.Y/factor))
+	for y := 0; y < size.Y/factor; y++ {
+		for x := 0; x < size.X/factor; x++ {
+			var sum [4]int
+			for dy := 0; dy < factor; dy++ {
+				i := img.PixOffset(x*factor, y*factor+dy)
+				for dx := 0; dx < factor*4; dx++ {
+					sum[dx%4] += int(img.Pix[i+dx])
+				}
+			}
+			j := small.PixOffset(x, y)
+			for c := range sum {
+				small.Pix[j+c] = uint8(sum[c] / (factor * factor))
+			}
+		}
+	}
+	return small
+}
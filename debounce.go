@@ -0,0 +1,47 @@
+package main
+
+import "time"
+
+// debouncer only accepts a new reading once it has been the same for the whole debounce period.
+// The reed switch on the door flickers as the door swings, so raw readings can't be trusted on their own.
+type debouncer struct {
+	period    time.Duration
+	filtered  interface{}
+	candidate interface{}
+	since     time.Time
+}
+
+// update Returns the filtered value, and whether it changed. The very first reading counts as a change.
+func (d *debouncer) update(raw interface{}, now time.Time) (filtered interface{}, changed bool) {
+	if d.filtered == nil { // First reading, nothing to compare against yet
+		d.filtered, d.candidate, d.since = raw, raw, now
+		return d.filtered, true
+	}
+	if raw != d.candidate {
+		d.candidate, d.since = raw, now
+	}
+	if d.candidate != d.filtered && now.Sub(d.since) >= d.period {
+		d.filtered, changed = d.candidate, true
+	}
+	return d.filtered, changed
+}
+
+// holdFilter keeps a value for at least the hold time after it last changed, so the sign and the relay can't
+// flap between Open and Closed even if the inputs do.
+type holdFilter struct {
+	hold    time.Duration
+	value   bool
+	changed time.Time
+	started bool
+}
+
+func (h *holdFilter) update(v bool, now time.Time) bool {
+	if !h.started {
+		h.value, h.changed, h.started = v, now, true
+		return h.value
+	}
+	if v != h.value && now.Sub(h.changed) >= h.hold {
+		h.value, h.changed = v, now
+	}
+	return h.value
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	start := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	type reading struct {
+		after       time.Duration
+		raw         interface{}
+		wantValue   interface{}
+		wantChanged bool
+	}
+	for _, test := range []struct {
+		name     string
+		readings []reading
+	}{
+		{"first reading counts as a change", []reading{
+			{0, true, true, true},
+			{time.Second, true, true, false},
+		}},
+		{"steady for the period", []reading{
+			{0, false, false, true},
+			{100 * time.Millisecond, true, false, false},
+			{200 * time.Millisecond, true, false, false},
+			{400 * time.Millisecond, true, true, true},
+			{500 * time.Millisecond, true, true, false},
+		}},
+		{"flicker starts the wait over", []reading{
+			{0, false, false, true},
+			{100 * time.Millisecond, true, false, false},
+			{300 * time.Millisecond, false, false, false},
+			{400 * time.Millisecond, true, false, false},
+			{600 * time.Millisecond, true, false, false},
+			{700 * time.Millisecond, true, true, true},
+		}},
+		{"going back before the period isn't a change", []reading{
+			{0, stateShifts, stateShifts, true},
+			{100 * time.Millisecond, stateOpenForced, stateShifts, false},
+			{200 * time.Millisecond, stateShifts, stateShifts, false},
+			{time.Second, stateShifts, stateShifts, false},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			d := &debouncer{period: 300 * time.Millisecond}
+			for _, r := range test.readings {
+				value, changed := d.update(r.raw, start.Add(r.after))
+				if value != r.wantValue || changed != r.wantChanged {
+					t.Errorf("after %v: got %v, %v, want %v, %v", r.after, value, changed, r.wantValue, r.wantChanged)
+				}
+			}
+		})
+	}
+}
+
+func TestHoldFilter(t *testing.T) {
+	start := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	type reading struct {
+		after time.Duration
+		v     bool
+		want  bool
+	}
+	for _, test := range []struct {
+		name     string
+		readings []reading
+	}{
+		{"first value is taken straight away", []reading{
+			{0, true, true},
+		}},
+		{"held after a change", []reading{
+			{0, false, false},
+			{time.Second, true, false}, // The first value is held too
+			{5 * time.Second, true, true},
+			{6 * time.Second, false, true},
+			{9 * time.Second, false, true},
+			{10 * time.Second, false, false},
+		}},
+		{"flapping inputs don't flap", []reading{
+			{0, true, true},
+			{5 * time.Second, false, false},
+			{6 * time.Second, true, false},
+			{7 * time.Second, false, false},
+			{8 * time.Second, true, false},
+			{10 * time.Second, true, true},
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			h := &holdFilter{hold: 5 * time.Second}
+			for _, r := range test.readings {
+				if got := h.update(r.v, start.Add(r.after)); got != r.want {
+					t.Errorf("after %v: got %v, want %v", r.after, got, r.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	postPeriod        = time.Duration(1 * time.Second)
+	minPostBackoff    = time.Duration(1 * time.Second)
+	maxPostErrorBytes = 200 // How much of a failed response's body goes in the error
+)
+
+// postClient is used for everything posted, so nothing can hang for longer than post.timeout.
+var postClient = &http.Client{}
+
+// queuedPost is the status at a transition, kept until it has been delivered.
+type queuedPost struct {
+	Time time.Time       `json:"time"`
+	Body json.RawMessage `json:"body"`
+}
+
+// postMetrics is how delivery is going, served at /debug/posts.
+type postMetrics struct {
+	Delivered   int       // Posts that got a 2xx
+	Failed      int       // Attempts that didn't
+	Dropped     int       // Transitions given up on, because the queue was full or the server refused them
+	Queued      int       // Transitions waiting to be delivered
+	Backoff     string    // How long until it tries again after a failure
+	LastSuccess time.Time // Zero if nothing has been delivered yet
+	LastFailure time.Time
+	LastError   string
+}
+
+var postStats postMetrics
+var postStatsLock sync.Mutex
+
+// statusPoster delivers the status to post.url. The latest status is posted every second, and if that fails it's
+// just replaced by the next one. Transitions matter more, so with the v2 post.format, which says when each one
+// happened, they're queued on disk until they get through, and posted oldest first before the latest status. After
+// a failure it waits longer each time before trying again.
+type statusPoster struct {
+	lock    sync.Mutex
+	latest  []byte
+	queue   []queuedPost
+	wake    chan struct{}
+	backoff time.Duration // 0 while posts are getting through
+	retryAt time.Time
+}
+
+// spawnStatusPoster Starts delivering, with whatever was still queued from last time. It's nil if there's nowhere to
+// post to.
+func spawnStatusPoster() *statusPoster {
+	if config.Post.APIKey == "" || config.Post.URL == "" {
+		return nil
+	}
+	postClient.Timeout = duration(config.Post.Timeout)
+	p := &statusPoster{wake: make(chan struct{}, 1)}
+	p.queue = readPostQueue(config.Post.QueueFile)
+	p.updateStats()
+	if len(p.queue) > 0 {
+		postLog.Info("Posting transitions queued before the restart", "queued", len(p.queue))
+	}
+	spawnWorker("status poster", func(ctx context.Context) {
+		tick := time.NewTicker(postPeriod)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+			case <-p.wake:
+			case <-ctx.Done():
+				return
+			}
+			p.deliver(ctx)
+		}
+	})
+	return p
+}
+
+// setLatest Replaces the status to be posted next.
+func (p *statusPoster) setLatest(body []byte) {
+	p.lock.Lock()
+	p.latest = body
+	p.lock.Unlock()
+}
+
+// enqueue Keeps the status at a transition until it's delivered. When the queue is full the oldest is dropped.
+func (p *statusPoster) enqueue(t time.Time, body []byte) {
+	p.lock.Lock()
+	p.queue = append(p.queue, queuedPost{t, body})
+	dropped := 0
+	if over := len(p.queue) - config.Post.QueueSize; over > 0 {
+		p.queue, dropped = p.queue[over:], over
+	}
+	p.saveQueue()
+	p.lock.Unlock()
+
+	postStatsLock.Lock()
+	postStats.Dropped += dropped
+	postStatsLock.Unlock()
+	if dropped > 0 {
+		postLog.Warn("Post queue is full, dropped the oldest transitions", "dropped", dropped)
+	}
+	p.updateStats()
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver Posts whatever is queued, and then the latest status, unless it's waiting after a failure.
+func (p *statusPoster) deliver(ctx context.Context) {
+	p.lock.Lock()
+	waiting := time.Now().Before(p.retryAt)
+	p.lock.Unlock()
+	if waiting {
+		return
+	}
+	// The queue file is only rewritten once all that can be delivered has been, rather than after each one.
+	removed := 0
+	defer func() {
+		if removed > 0 {
+			p.lock.Lock()
+			p.saveQueue()
+			p.lock.Unlock()
+		}
+	}()
+	for {
+		p.lock.Lock()
+		if len(p.queue) == 0 {
+			p.lock.Unlock()
+			break
+		}
+		next := p.queue[0]
+		p.lock.Unlock()
+
+		err := post(ctx, next.Body)
+		if err != nil && !isPermanent(err) {
+			p.failed(err)
+			return
+		}
+		p.lock.Lock()
+		p.queue = p.queue[1:]
+		removed++
+		p.lock.Unlock()
+		if err != nil {
+			postLog.Error("Server refused a transition, dropping it", "time", next.Time.Format(time.RFC3339), "err", err)
+			postStatsLock.Lock()
+			postStats.Dropped++
+			postStatsLock.Unlock()
+		} else {
+			p.succeeded()
+		}
+	}
+
+	p.lock.Lock()
+	latest := p.latest
+	p.latest = nil // It's only worth posting once, the next one is on its way
+	p.lock.Unlock()
+	if latest == nil {
+		return
+	}
+	if err := post(ctx, latest); err != nil {
+		p.failed(err)
+		return
+	}
+	p.succeeded()
+}
+
+func (p *statusPoster) succeeded() {
+	p.lock.Lock()
+	recovered := p.backoff > 0
+	p.backoff, p.retryAt = 0, time.Time{}
+	p.lock.Unlock()
+	if recovered {
+		postLog.Info("Posting again")
+	}
+	postStatsLock.Lock()
+	postStats.Delivered++
+	postStats.LastSuccess = time.Now()
+	postStatsLock.Unlock()
+	p.updateStats()
+}
+
+func (p *statusPoster) failed(err error) {
+	if rootContext.Err() != nil {
+		return // Cut off by shutting down, not the server's fault
+	}
+	p.lock.Lock()
+	if p.backoff *= 2; p.backoff < minPostBackoff {
+		p.backoff = minPostBackoff
+	} else if max := duration(config.Post.MaxBackoff); p.backoff > max {
+		p.backoff = max
+	}
+	p.retryAt = time.Now().Add(p.backoff)
+	backoff := p.backoff
+	p.lock.Unlock()
+	postLog.Error("Failed to post", "err", err, "retryIn", backoff)
+	postStatsLock.Lock()
+	postStats.Failed++
+	postStats.LastFailure, postStats.LastError = time.Now(), err.Error()
+	postStatsLock.Unlock()
+	p.updateStats()
+}
+
+func (p *statusPoster) updateStats() {
+	p.lock.Lock()
+	queued, backoff := len(p.queue), p.backoff
+	p.lock.Unlock()
+	postStatsLock.Lock()
+	postStats.Queued, postStats.Backoff = queued, backoff.String()
+	postStatsLock.Unlock()
+}
+
+// saveQueue Writes the queue to post.queueFile, one transition per line. Has to be called with the lock held.
+func (p *statusPoster) saveQueue() {
+	if config.Post.QueueFile == "" {
+		return
+	}
+	err := writeFileAtomically(config.Post.QueueFile, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, queued := range p.queue {
+			if err := encoder.Encode(queued); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		postLog.Error("Failed to save the post queue", "file", config.Post.QueueFile, "err", err)
+	}
+}
+
+// readPostQueue Reads the transitions that were still waiting when the sign last stopped.
+func readPostQueue(filename string) (queue []queuedPost) {
+	if filename == "" {
+		return nil
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		postLog.Error("Failed to read the post queue", "file", filename, "err", err)
+		return nil
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var queued queuedPost
+		if err := json.Unmarshal(scanner.Bytes(), &queued); err != nil {
+			postLog.Warn("Skipping a line of the post queue", "file", filename, "err", err)
+			continue
+		}
+		queue = append(queue, queued)
+	}
+	if over := len(queue) - config.Post.QueueSize; over > 0 {
+		queue = queue[over:]
+	}
+	return queue
+}
+
+// postError is a response that wasn't a 2xx.
+type postError struct {
+	status int
+	msg    string
+}
+
+func (e *postError) Error() string {
+	return e.msg
+}
+
+// isPermanent Whether trying again won't help, because the server said the post itself is wrong. Anything else,
+// including a wrong or rotated API key, is worth trying again once it's been fixed.
+func isPermanent(err error) bool {
+	pe, ok := err.(*postError)
+	return ok && (pe.status == http.StatusBadRequest || pe.status == http.StatusRequestEntityTooLarge ||
+		pe.status == http.StatusUnprocessableEntity)
+}
+
+// post Sends body to post.url, and only counts it as delivered if the server says so.
+func post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequest("POST", config.Post.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Add("content-type", "application/json")
+	req.Header.Add("x-api-key", config.Post.APIKey)
+	resp, err := postClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxPostErrorBytes))
+	io.Copy(ioutil.Discard, resp.Body) // So the connection can be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &postError{resp.StatusCode, fmt.Sprintf("%v: %s", resp.Status, bytes.TrimSpace(respBody))}
+	}
+	return nil
+}
+
+func servePostMetrics(w http.ResponseWriter, r *http.Request) {
+	postStatsLock.Lock()
+	stats := postStats
+	postStatsLock.Unlock()
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIsPermanent(t *testing.T) {
+	for _, test := range []struct {
+		err  error
+		want bool
+	}{
+		{&postError{status: http.StatusBadRequest}, true},
+		{&postError{status: http.StatusRequestEntityTooLarge}, true},
+		{&postError{status: http.StatusUnprocessableEntity}, true},
+		{&postError{status: http.StatusUnauthorized}, false}, // The key can be fixed
+		{&postError{status: http.StatusForbidden}, false},
+		{&postError{status: http.StatusNotFound}, false},
+		{&postError{status: http.StatusRequestTimeout}, false},
+		{&postError{status: http.StatusTooManyRequests}, false},
+		{&postError{status: http.StatusInternalServerError}, false},
+		{&postError{status: http.StatusBadGateway}, false},
+		{errors.New("connection refused"), false},
+	} {
+		if got := isPermanent(test.err); got != test.want {
+			t.Errorf("isPermanent(%v) = %v, want %v", test.err, got, test.want)
+		}
+	}
+}
+
+// withPostConfig Sets config.Post for a test, with the queue in a file of its own.
+func withPostConfig(t *testing.T, url string, queueSize int) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.Post.URL, config.Post.APIKey = url, "key"
+	config.Post.QueueFile = filepath.Join(t.TempDir(), "post-queue.jsonl")
+	config.Post.QueueSize = queueSize
+	config.Post.MaxBackoff = "1m0s"
+}
+
+func newTestPoster() *statusPoster {
+	return &statusPoster{wake: make(chan struct{}, 1)}
+}
+
+func queuedBodies(queue []queuedPost) []string {
+	var bodies []string
+	for _, q := range queue {
+		bodies = append(bodies, string(q.Body))
+	}
+	return bodies
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestEnqueueDropsOldest(t *testing.T) {
+	withPostConfig(t, "http://localhost", 3)
+	p := newTestPoster()
+	start := time.Now()
+	for i, body := range []string{`1`, `2`, `3`, `4`, `5`} {
+		p.enqueue(start.Add(time.Duration(i)*time.Second), []byte(body))
+	}
+	want := []string{`3`, `4`, `5`}
+	if got := queuedBodies(p.queue); !equalStrings(got, want) {
+		t.Errorf("queue is %v, want %v", got, want)
+	}
+	if got := queuedBodies(readPostQueue(config.Post.QueueFile)); !equalStrings(got, want) {
+		t.Errorf("queue file has %v, want %v", got, want)
+	}
+
+	// A smaller queue size after a restart keeps the newest
+	config.Post.QueueSize = 2
+	if got, want := queuedBodies(readPostQueue(config.Post.QueueFile)), []string{`4`, `5`}; !equalStrings(got, want) {
+		t.Errorf("read back %v, want %v", got, want)
+	}
+}
+
+func TestReadPostQueueSkipsBrokenLines(t *testing.T) {
+	withPostConfig(t, "http://localhost", 10)
+	content := `{"time": "2019-02-12T15:00:00Z", "body": {"a": 1}}` + "\nnot json\n" +
+		`{"time": "2019-02-12T15:01:00Z", "body": {"a": 2}}` + "\n"
+	if err := os.WriteFile(config.Post.QueueFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queuedBodies(readPostQueue(config.Post.QueueFile)), []string{`{"a": 1}`, `{"a": 2}`}; !equalStrings(got, want) {
+		t.Errorf("read %v, want %v", got, want)
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		status       int
+		wantQueued   int
+		wantBackoff  bool
+		wantDropped  int
+		wantReceived []string // Oldest first and then the latest, or stopping at the first failure
+	}{
+		{"delivered", http.StatusOK, 0, false, 0, []string{`1`, `2`, `3`, `"latest"`}},
+		// Each transition is dropped, and then the latest fails like any other post
+		{"refused", http.StatusBadRequest, 0, true, 3, []string{`1`, `2`, `3`, `"latest"`}},
+		{"wrong key", http.StatusUnauthorized, 3, true, 0, []string{`1`}},
+		{"server down", http.StatusServiceUnavailable, 3, true, 0, []string{`1`}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var received []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var body json.RawMessage
+				json.NewDecoder(r.Body).Decode(&body)
+				received = append(received, string(body))
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+			withPostConfig(t, server.URL, 10)
+			postStatsLock.Lock()
+			postStats = postMetrics{}
+			postStatsLock.Unlock()
+
+			p := newTestPoster()
+			start := time.Now()
+			for i, body := range []string{`1`, `2`, `3`} {
+				p.enqueue(start.Add(time.Duration(i)*time.Second), []byte(body))
+			}
+			p.setLatest([]byte(`"latest"`))
+			p.deliver(context.Background())
+
+			if len(p.queue) != test.wantQueued {
+				t.Errorf("%v still queued, want %v", len(p.queue), test.wantQueued)
+			}
+			if got := len(readPostQueue(config.Post.QueueFile)); got != test.wantQueued {
+				t.Errorf("%v in the queue file, want %v", got, test.wantQueued)
+			}
+			if (p.backoff > 0) != test.wantBackoff {
+				t.Errorf("backing off for %v, want backing off: %v", p.backoff, test.wantBackoff)
+			}
+			if postStats.Dropped != test.wantDropped {
+				t.Errorf("dropped %v, want %v", postStats.Dropped, test.wantDropped)
+			}
+			if !equalStrings(received, test.wantReceived) {
+				t.Errorf("server got %v, want %v", received, test.wantReceived)
+			}
+
+			// Nothing is tried again until the backoff is up
+			received = nil
+			p.deliver(context.Background())
+			if test.wantBackoff && len(received) > 0 {
+				t.Errorf("posted %v while backing off", received)
+			}
+		})
+	}
+}
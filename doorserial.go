@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// The Arduino door sensor answers any byte it is sent with the sensor value as two bytes, high byte first.
+const (
+	doorSerialRequest     = '?'
+	doorSerialReadTimeout = time.Duration(500 * time.Millisecond)
+	// Without a reading in this long the sensor counts as faulty, even if the port hasn't said anything is wrong.
+	doorSerialStaleTime = time.Duration(5 * time.Second)
+)
+
+var supportedBaudRates = []int{9600, 19200, 38400, 57600, 115200}
+
+// serialDoorSensor turns the Arduino's analog readings into whether the door is open. The readings are noisy, so
+// they go through a moving average, and the average has to cross the threshold by the hysteresis to change state.
+// The port is read in a goroutine of its own, so a slow or unplugged Arduino can't hold up the other inputs.
+type serialDoorSensor struct {
+	device            string
+	port              io.ReadWriteCloser
+	timeout           time.Duration
+	doorMovingAverage movingAverage
+	threshold         int
+	hysteresis        int
+
+	// Set by the reader, and read by read.
+	lock   sync.Mutex
+	open   bool
+	err    error
+	readAt time.Time // The last good reading
+	done   chan struct{}
+}
+
+func openSerialDoorSensor(c SerialConfig) (*serialDoorSensor, error) {
+	port, err := openSerial(c.Device, c.Baud)
+	if err != nil {
+		return nil, err
+	}
+	return newSerialDoorSensor(c, port), nil
+}
+
+// newSerialDoorSensor Uses port as the sensor, which is handy for a pseudo-terminal standing in for the Arduino.
+func newSerialDoorSensor(c SerialConfig, port io.ReadWriteCloser) *serialDoorSensor {
+	return &serialDoorSensor{
+		device:            c.Device,
+		port:              port,
+		timeout:           doorSerialReadTimeout,
+		doorMovingAverage: movingAverage{samples: make([]int, c.Window)},
+		threshold:         c.Threshold,
+		hysteresis:        c.Hysteresis,
+		done:              make(chan struct{}),
+	}
+}
+
+// spawnReader Reads the sensor every period until the sign stops or it's closed. Only the sign needs this, calibrate
+// reads the raw values itself.
+func (sd *serialDoorSensor) spawnReader(period time.Duration) {
+	sd.readOnce() // So the first sample has something to go on
+	spawnWorker("door serial reader", func(ctx context.Context) {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sd.readOnce()
+			case <-ctx.Done():
+				return
+			case <-sd.done:
+				return
+			}
+		}
+	})
+}
+
+func (sd *serialDoorSensor) readOnce() {
+	value, err := sd.readValue()
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if err == nil {
+		sd.update(value)
+		sd.readAt = time.Now()
+	}
+	sd.err = err
+}
+
+// readValue Asks the Arduino for a single raw sensor value.
+func (sd *serialDoorSensor) readValue() (int, error) {
+	if _, err := sd.port.Write([]byte{doorSerialRequest}); err != nil {
+		return 0, err
+	}
+	setReadDeadline(sd.port, time.Now().Add(sd.timeout))
+	var buf [2]byte
+	if _, err := io.ReadFull(sd.port, buf[:]); err != nil {
+		// Whatever is left of the answer would be read as the start of the next one.
+		sd.drain()
+		return 0, err
+	}
+	return int(buf[0])*256 + int(buf[1]), nil
+}
+
+func (sd *serialDoorSensor) drain() {
+	var buf [64]byte
+	for {
+		setReadDeadline(sd.port, time.Now().Add(sd.timeout/10))
+		if n, err := sd.port.Read(buf[:]); n == 0 || err != nil {
+			return
+		}
+	}
+}
+
+// read Whether the door is open as of the latest reading, and what went wrong with the last one if anything did.
+func (sd *serialDoorSensor) read() (bool, error) {
+	sd.lock.Lock()
+	defer sd.lock.Unlock()
+	if sd.err == nil && time.Since(sd.readAt) > doorSerialStaleTime {
+		return sd.open, fmt.Errorf("no reading since %v", sd.readAt.Format(time.Kitchen))
+	}
+	return sd.open, sd.err
+}
+
+// update Adds value to the moving average, and moves open if the average is far enough past the threshold.
+func (sd *serialDoorSensor) update(value int) {
+	sd.doorMovingAverage.add(value)
+	if avg := sd.doorMovingAverage.avg(); avg > sd.threshold+sd.hysteresis {
+		sd.open = true
+	} else if avg < sd.threshold-sd.hysteresis {
+		sd.open = false
+	}
+}
+
+// close Stops the reader if it's still going, and closes the port, which also gets it out of a read that's waiting.
+func (sd *serialDoorSensor) close() {
+	close(sd.done)
+	sd.port.Close()
+}
+
+// setReadDeadline Only works for ports that support it, anything else just blocks until there's something to read.
+func setReadDeadline(port io.Reader, t time.Time) {
+	if d, ok := port.(interface{ SetReadDeadline(time.Time) error }); ok {
+		d.SetReadDeadline(t)
+	}
+}
+
+// movingAverage is the average of the last len(samples) values.
+type movingAverage struct {
+	samples []int
+	next    int
+	filled  bool
+}
+
+func (ma *movingAverage) add(v int) {
+	ma.samples[ma.next] = v
+	ma.next = (ma.next + 1) % len(ma.samples)
+	if ma.next == 0 {
+		ma.filled = true
+	}
+}
+
+func (ma *movingAverage) avg() int {
+	n := len(ma.samples)
+	if !ma.filled {
+		n = ma.next
+	}
+	if n == 0 {
+		return 0
+	}
+	sum := 0
+	for _, v := range ma.samples[:n] {
+		sum += v
+	}
+	return sum / n
+}
+
+func validateSerialConfig(name string, c SerialConfig) error {
+	if c.Device == "" {
+		return nil
+	}
+	baudOK := false
+	for _, baud := range supportedBaudRates {
+		baudOK = baudOK || baud == c.Baud
+	}
+	if !baudOK {
+		return fmt.Errorf("hardware.%v: baud should be one of %v", name, supportedBaudRates)
+	}
+	if c.Threshold <= 0 {
+		return fmt.Errorf("hardware.%v: threshold has to be set, see the README on calibrating the sensor", name)
+	}
+	if c.Hysteresis < 0 {
+		return fmt.Errorf("hardware.%v: hysteresis can't be negative", name)
+	}
+	if c.Window < 1 {
+		return fmt.Errorf("hardware.%v: window has to be at least 1", name)
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// openPty Opens a pseudo-terminal to stand in for the Arduino. The sensor opens the returned device like any other
+// serial port, and the test plays the Arduino on master.
+func openPty(t *testing.T) (master *os.File, device string) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pseudo-terminals:", err)
+	}
+	t.Cleanup(func() { master.Close() })
+	conn, err := master.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unlock int32
+	var n uint32
+	var errno syscall.Errno
+	conn.Control(func(fd uintptr) {
+		if _, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); errno != 0 {
+			return
+		}
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n)))
+	})
+	if errno != 0 {
+		t.Skip("no pseudo-terminals:", errno)
+	}
+	return master, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+// fakeReply is what the fake Arduino answers a request with, after delay.
+type fakeReply struct {
+	bytes []byte
+	delay time.Duration
+}
+
+func reading(v int) []byte {
+	return []byte{byte(v >> 8), byte(v)}
+}
+
+// fakeArduino Answers each request with the next of replies, and stops answering once they run out.
+func fakeArduino(master *os.File, replies ...fakeReply) {
+	go func() {
+		var buf [1]byte
+		for i := 0; ; i++ {
+			if _, err := master.Read(buf[:]); err != nil {
+				return
+			}
+			if buf[0] != doorSerialRequest || i >= len(replies) {
+				continue
+			}
+			time.Sleep(replies[i].delay)
+			master.Write(replies[i].bytes)
+		}
+	}()
+}
+
+func openTestSensor(t *testing.T, c SerialConfig, timeout time.Duration) (*serialDoorSensor, *os.File) {
+	master, device := openPty(t)
+	c.Device, c.Baud = device, 9600
+	port, err := openSerial(c.Device, c.Baud)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor := newSerialDoorSensor(c, port)
+	sensor.timeout = timeout
+	t.Cleanup(sensor.close)
+	return sensor, master
+}
+
+func TestSerialDoorSensorReadValue(t *testing.T) {
+	sensor, master := openTestSensor(t, SerialConfig{Window: 1}, 500*time.Millisecond)
+	fakeArduino(master, fakeReply{bytes: reading(350)}, fakeReply{bytes: []byte{0x12, 0x34}}, fakeReply{bytes: reading(0)})
+	for _, want := range []int{350, 0x1234, 0} {
+		if got, err := sensor.readValue(); err != nil || got != want {
+			t.Errorf("readValue() = %v, %v, want %v", got, err, want)
+		}
+	}
+}
+
+func TestSerialDoorSensorTimeout(t *testing.T) {
+	const timeout = time.Second // Long enough that the late answer reliably turns up while it's being drained
+	sensor, master := openTestSensor(t, SerialConfig{Window: 1}, timeout)
+	fakeArduino(master,
+		fakeReply{bytes: reading(999)[:1]},                           // Half an answer
+		fakeReply{bytes: reading(123)},                               // Fine again
+		fakeReply{bytes: reading(999), delay: timeout + timeout/100}, // Just too late, so it has to be drained
+		fakeReply{bytes: reading(456)},
+	)
+	for i, want := range []int{-1, 123, -1, 456} {
+		got, err := sensor.readValue()
+		if want < 0 {
+			if err == nil {
+				t.Errorf("reading %v: readValue() = %v, want a timeout", i, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("reading %v: readValue() = %v, %v, want %v", i, got, err, want)
+		}
+	}
+}
+
+func TestSerialDoorSensorThreshold(t *testing.T) {
+	sensor := newSerialDoorSensor(SerialConfig{Threshold: 350, Hysteresis: 20, Window: 3}, nil)
+	for i, step := range []struct {
+		value   int
+		average int
+		open    bool
+	}{
+		{300, 300, false},
+		{300, 300, false},
+		{400, 333, false},
+		{400, 366, false}, // Past the threshold, but not the hysteresis
+		{400, 400, true},
+		{340, 380, true},
+		{340, 360, true},
+		{340, 340, true}, // Below the threshold, but not the hysteresis
+		{300, 326, false},
+	} {
+		sensor.update(step.value)
+		if avg := sensor.doorMovingAverage.avg(); avg != step.average || sensor.open != step.open {
+			t.Errorf("step %v: after %v, average %v and open %v, want %v and %v", i, step.value, avg, sensor.open, step.average, step.open)
+		}
+	}
+}
+
+func TestSerialDoorSensorReader(t *testing.T) {
+	sensor, master := openTestSensor(t, SerialConfig{Threshold: 350, Window: 2}, 100*time.Millisecond)
+	var replies []fakeReply
+	for i := 0; i < 5; i++ {
+		replies = append(replies, fakeReply{bytes: reading(500)})
+	}
+	fakeArduino(master, replies...) // And then it's unplugged
+	sensor.spawnReader(10 * time.Millisecond)
+	if open, err := sensor.read(); !open || err != nil {
+		t.Fatalf("read() = %v, %v straight away, want true", open, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		open, err := sensor.read()
+		if err != nil {
+			if !open {
+				t.Errorf("read() = false after the Arduino stopped answering, want the last state")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("read() never noticed the Arduino stopped answering")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
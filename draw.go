@@ -12,7 +12,8 @@ import (
 )
 
 const font = "Helvetica-Bold.ttf" // Helvetica font is beautiful for long distance reading.
-const width, height = 1920, 1080
+// The size of the screen, from config.Display. The layout is made for 1920x1080.
+var width, height int32 = 1920, 1080
 
 var (
 	// A bunch of standard colors from the official guidelines (somewhere) for road signs
@@ -29,14 +30,29 @@ var (
 )
 
 func (s *SignState) draw() {
+	s.compose()
+	s.Renderer.Present()
+}
+
+// compose Draws the frame without presenting it. Only until it's presented can it be read back, e.g. by snapshot.
+func (s *SignState) compose() {
 	s.Renderer.SetDrawColor(s.BackgroundFill.R, s.BackgroundFill.G, s.BackgroundFill.B, s.BackgroundFill.A)
 	s.Renderer.Clear()
-	s.blitDesignStudio()      // Draw the words "Design Studio"
-	s.blitWhetherOpen(s.Open) // Handles whether the studio is open
+	if len(s.Faults) > 0 {
+		s.blitFault() // Take the place of the header so it can't be missed
+	} else {
+		s.blitDesignStudio() // Draw the words "Design Studio"
+	}
+	s.blitWhetherOpen(s.phaseOpen()) // Handles whether the studio is open
+	s.blitFull()                     // Asks people to wait when the studio is at capacity
 	s.blitWhenOpens()
 	s.blitMentorOnDuty() // Mentor name if there is one on duty
+	s.blitOverride()     // Why it was forced open or closed remotely
+	s.blitMode()         // Subtitle for a custom mode
+	s.blitBreak()        // When the mentor will be back
+	s.blitClosingSoon()  // How long until closing
 	s.blitTime()
-	s.Renderer.Present()
+	s.snapshotIfDue()
 }
 
 var desiredFontSizes = [3]int{120, 250, 580}
@@ -50,6 +66,17 @@ const (
 	mentorPrefixStrf    = "Mentor%v: "
 	whetherOpensOpenAt  = "Should Open At: "
 	whetherOpensNotOpen = "Not Open Today"
+	overrideNoReason    = "Set Remotely"
+	overrideUntilStrf   = "Until %v"
+	fullPleaseWait      = "Please Wait"
+	fullOccupancyStrf   = "%v of %v Inside"
+	breakTitle          = "Back Soon"
+	breakBackAtStrf     = "Back At %v"
+	breakLeftStrf       = "%d:%02d Left"
+	closingAtStrf       = "Closes At %v"
+	closingInStrf       = "Closing in %v Min"
+	faultSize           = 120
+	faultStrf           = "Sensor Fault: %v"
 )
 
 func makePluralHandlingMentorString(subtitle string, onDutyText bool) string {
@@ -64,7 +91,7 @@ func makePluralHandlingMentorString(subtitle string, onDutyText bool) string {
 }
 
 func (s *SignState) blitWhenOpens() {
-	if !s.Open && s.SwitchValue == stateShifts {
+	if !s.Open && s.SwitchValue == stateShifts && s.Override == nil && !s.onBreak() {
 		var subHeaderToBlit string
 		if s.Subtitle == "" {
 			subHeaderToBlit = whetherOpensNotOpen
@@ -74,21 +101,30 @@ func (s *SignState) blitWhenOpens() {
 			subHeaderToBlit = whetherOpensOpenAt
 		}
 		// White text
-		s.blitLeft(subtitleSize, subHeaderToBlit, white, width*1/64, int32(height-s.Fonts[subtitleSize].Height()*2))
-		s.blitLeft(subtitleSize, s.Subtitle, white, width*1/64, int32(height-s.Fonts[subtitleSize].Height()))
+		s.blitLeft(subtitleSize, subHeaderToBlit, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+		s.blitLeft(subtitleSize, s.Subtitle, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
 	}
 }
 
 func (s *SignState) blitDesignStudio() {
 	// Set the drawing color to be white
 	str := "Design Studio"
-	s.blitCentered(studioSize, str, white, width/2, int32(s.Fonts[studioSize].Height()/2))
+	s.blitCentered(studioSize, str, s.foreground(), width/2, int32(s.Fonts[studioSize].Height()/2))
+}
+
+func (s *SignState) blitFault() {
+	// Black on yellow, like a warning sign, in a band across the top where "Design Studio" would be.
+	bandHeight := int32(s.Fonts[studioSize].Height())
+	s.Renderer.SetDrawColor(yellow.R, yellow.G, yellow.B, yellow.A)
+	s.Renderer.FillRect(&sdl.Rect{X: 0, Y: 0, W: width, H: bandHeight})
+	str := fmt.Sprintf(faultStrf, strings.Join(s.Faults.sensors(), " & "))
+	s.blitCentered(faultSize, str, black, width/2, bandHeight/2)
 }
 
 func (s *SignState) blitCentered(size int, text string, color sdl.Color, x, y int32) {
 	sw, sh, err := s.Fonts[size].SizeUTF8(text)
 	if err != nil {
-		fmt.Println(err)
+		displayLog.Error("Failed to size text", "text", text, "err", err)
 	} else {
 		s.blitLeft(size, text, color, x-int32(sw)/2, y-int32(sh)/2)
 	}
@@ -118,7 +154,7 @@ func (s *SignState) blitLeft(size int, text string, color sdl.Color, x, y int32)
 		var surf *sdl.Surface
 		surf, err = s.Fonts[size].RenderUTF8Blended(text, color)
 		if err != nil {
-			fmt.Println(err)
+			displayLog.Error("Failed to render text", "text", text, "err", err)
 			if surf != nil {
 				surf.Free()
 				surf = nil
@@ -152,26 +188,101 @@ func (s *SignState) blitLeft(size int, text string, color sdl.Color, x, y int32)
 }
 
 func (s *SignState) blitWhetherOpen(open bool) {
-	// White "Closed" on red background.
-	s.BackgroundFill = red
-	// White "Open" on green background.
-	if open {
-		s.BackgroundFill = green
+	switch s.Phase {
+	case phaseFull: // White "Full" on blue background, it's still open but people need to wait.
+		s.BackgroundFill = blue
+	case phaseMode: // Whatever the config says for custom modes
+		s.BackgroundFill = modeColors[s.Mode.Color]
+	case phaseBreak: // White "Back Soon" on purple, not quite closed
+		s.BackgroundFill = purple
+	case phaseClosingSoon: // Black "Open" on orange, like a road work sign
+		s.BackgroundFill = orange
+	default:
+		// White "Open" on green background, or white "Closed" on red.
+		s.BackgroundFill = red
+		if open {
+			s.BackgroundFill = green
+		}
+	}
+	// Draw that, centered and big. Custom titles can be too long for that, so they get smaller.
+	size := titleSize
+	if w, _, err := s.Fonts[size].SizeUTF8(s.Title); err == nil && int32(w) > width {
+		size = studioSize
 	}
-	// Draw that, centered and big.
-	s.blitCentered(titleSize, s.Title, white, width/2, height*7/16)
+	s.blitCentered(size, s.Title, s.foreground(), width/2, height*7/16)
 }
 
 func (s *SignState) blitMentorOnDuty() {
 	// Open + normal operation.
-	if s.Open && s.SwitchValue == stateShifts {
+	if s.phaseOpen() && s.SwitchValue == stateShifts && s.Override == nil && !s.Full && s.Phase != phaseClosingSoon {
 		// White text
-		s.blitLeft(subtitleSize, makePluralHandlingMentorString(s.Subtitle, true), white, width*1/64, int32(height-s.Fonts[subtitleSize].Height()*2))
-		s.blitLeft(subtitleSize, s.Subtitle, white, width*1/64, int32(height-s.Fonts[subtitleSize].Height()))
+		s.blitLeft(subtitleSize, makePluralHandlingMentorString(s.Subtitle, true), white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+		s.blitLeft(subtitleSize, s.Subtitle, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+	}
+}
+
+func (s *SignState) blitOverride() {
+	if s.Override == nil || s.Full {
+		return
+	}
+	reason := s.Override.Reason
+	if reason == "" {
+		reason = overrideNoReason
+	}
+	// White text, where the mentors or opening time would be
+	s.blitLeft(subtitleSize, reason, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+	s.blitLeft(subtitleSize, fmt.Sprintf(overrideUntilStrf, untilString(s.Override.Until, timeNow())), white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+}
+
+func (s *SignState) blitFull() {
+	if !s.Full {
+		return
+	}
+	// White text, where the mentors would be
+	s.blitLeft(subtitleSize, fullPleaseWait, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+	s.blitLeft(subtitleSize, fmt.Sprintf(fullOccupancyStrf, s.Occupancy, s.Capacity), white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+}
+
+func (s *SignState) blitMode() {
+	if s.Mode == nil || s.Full || s.Mode.Subtitle == "" {
+		return
+	}
+	// White text, where the mentors would be
+	s.blitLeft(subtitleSize, s.Mode.Subtitle, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+}
+
+func (s *SignState) blitBreak() {
+	if !s.onBreak() {
+		return
+	}
+	left := s.BreakUntil.Sub(timeNow())
+	if left < 0 {
+		left = 0
+	}
+	countdown := fmt.Sprintf(breakLeftStrf, int(left.Minutes()), int(left.Seconds())%60)
+	// White text, where the mentors would be
+	s.blitLeft(subtitleSize, s.Subtitle, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+	s.blitLeft(subtitleSize, countdown, white, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+}
+
+func (s *SignState) blitClosingSoon() {
+	if s.Phase != phaseClosingSoon {
+		return
+	}
+	// Black text, where the mentors would be
+	s.blitLeft(subtitleSize, fmt.Sprintf(closingAtStrf, s.ClosesAt.Format(time.Kitchen)), black, width*1/64, height-int32(s.Fonts[subtitleSize].Height()*2))
+	s.blitLeft(subtitleSize, s.Subtitle, black, width*1/64, height-int32(s.Fonts[subtitleSize].Height()))
+}
+
+// foreground White text, except on orange where only black is readable.
+func (s *SignState) foreground() sdl.Color {
+	if s.Phase == phaseClosingSoon {
+		return black
 	}
+	return white
 }
 
 func (s *SignState) blitTime() {
-	now := time.Now()
-	s.blitCentered(timeSize, now.Format(time.Kitchen), white, width*13/16, height*15/16)
+	now := timeNow()
+	s.blitCentered(timeSize, now.Format(time.Kitchen), s.foreground(), width*13/16, height*15/16)
 }
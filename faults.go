@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const defaultDoorStuckTime = time.Duration(72 * time.Hour)
+
+// sensorFault is something wrong with one of the inputs. Faults don't change how the sign decides whether it's
+// open, they're there so a broken sensor is noticed instead of quietly making the sign lie.
+type sensorFault struct {
+	Sensor  string // door, switch, motion, beam, button
+	Problem string
+}
+
+func (f sensorFault) String() string {
+	return f.Sensor + ": " + f.Problem
+}
+
+type sensorFaults []sensorFault
+
+func (fs sensorFaults) String() string {
+	strs := make([]string, len(fs))
+	for i, f := range fs {
+		strs[i] = f.String()
+	}
+	return strings.Join(strs, "; ")
+}
+
+// sensors Lists each faulty sensor once, for the fault banner.
+func (fs sensorFaults) sensors() (sensors []string) {
+	seen := make(map[string]bool)
+	for _, f := range fs {
+		if !seen[f.Sensor] {
+			sensors = append(sensors, f.Sensor)
+			seen[f.Sensor] = true
+		}
+	}
+	return
+}
+
+// findUnavailablePins Faults for pins that are in the config but couldn't be opened.
+func findUnavailablePins(hw HardwareConfig, si *SignInput) (faults sensorFaults) {
+	type sensorPin struct {
+		sensor string
+		config PinConfig
+		pin    gpioPin
+	}
+	pins := []sensorPin{
+		{"motion", hw.Motion, si.motionSensor},
+		{"beam", hw.OuterBeam, si.outerBeam},
+		{"beam", hw.InnerBeam, si.innerBeam},
+		{"button", hw.BreakButton, si.breakButton},
+	}
+	if len(hw.Rotary.Pins) > 0 {
+		for i, pin := range si.rotary {
+			pins = append(pins, sensorPin{"switch", hw.Rotary.Pins[i], pin})
+		}
+	} else {
+		pins = append(pins, sensorPin{"switch", hw.SwitchShifts, si.switchShifts}, sensorPin{"switch", hw.SwitchOpen, si.switchOpen})
+	}
+	if hw.DoorSerial.Device == "" {
+		pins = append(pins, sensorPin{"door", hw.Door, si.door})
+	} else if si.doorSerial == nil {
+		faults = append(faults, sensorFault{"door", hw.DoorSerial.Device + " unavailable"})
+	}
+	for _, p := range pins {
+		if p.config.Pin != "" && !p.pin.connected() {
+			faults = append(faults, sensorFault{p.sensor, p.config.Pin + " unavailable"})
+		}
+	}
+	return
+}
+
+// reportPinErr Keeps track of read errors for the fault state, and prints them only when they change instead of on
+// every sample.
+func (si *SignInput) reportPinErr(sensor, pin string, err error) {
+	msg := ""
+	if err != nil {
+		msg = fmt.Sprintf("%v read error: %v", pin, err)
+	}
+	if si.pinErrs[pin].Problem == msg {
+		return
+	}
+	if err != nil {
+		inputLog.Warn("Failed to read "+sensor, "pin", pin, "err", err)
+		si.pinErrs[pin] = sensorFault{sensor, msg}
+	} else {
+		inputLog.Info(sensor+" recovered", "pin", pin)
+		delete(si.pinErrs, pin)
+	}
+}
+
+// sampledFaults The faults the sampler knows about, in a stable order so they can be compared between samples.
+func (si *SignInput) sampledFaults() sensorFaults {
+	faults := append(sensorFaults(nil), si.unavailable...)
+	for _, f := range si.pinErrs {
+		faults = append(faults, f)
+	}
+	sort.Slice(faults, func(i, j int) bool {
+		return faults[i].String() < faults[j].String()
+	})
+	return faults
+}
+
+// Faults Everything currently wrong with the inputs, including ones that can only be seen over time like a door
+// sensor that never changes.
+func (si *SignInput) Faults(now time.Time) sensorFaults {
+	faults := si.faults
+	if si.doorStuckTime > 0 && si.hasDoorSensor() && !si.doorChangedAt.IsZero() && now.Sub(si.doorChangedAt) > si.doorStuckTime {
+		problem := "hasn't changed since " + si.doorChangedAt.Format("Mon Jan 2 3:04PM")
+		faults = append(append(sensorFaults(nil), faults...), sensorFault{"door", problem})
+	}
+	return faults
+}
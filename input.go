@@ -1,51 +1,152 @@
 package main
 
 import (
-	"fmt"
+	"net/http"
+	"time"
 
-	"github.com/mrmorphic/hwio"
 	"github.com/sameer/fsm/moore"
 )
 
+const (
+	defaultDoorDebounce   = time.Duration(500 * time.Millisecond)
+	defaultSwitchDebounce = time.Duration(100 * time.Millisecond)
+	defaultOpenHold       = time.Duration(5 * time.Second)
+	defaultSamplePeriod   = time.Duration(50 * time.Millisecond)
+	defaultOccupancyTime  = time.Duration(10 * time.Minute)
+)
+
 type SignInput struct {
-	gpio17, gpio27 hwio.Pin // BCM Pin 17, 27 (https://pinout.xyz/)
-	gpio18         hwio.Pin
+	// Wired up according to config.Hardware, see https://pinout.xyz/ for the numbering
+	switchShifts, switchOpen gpioPin
+	rotary                   []gpioPin // Instead of the DPDT switch, if there's a rotary switch
+	rotaryPositions          map[int]SwitchState
+	door                     gpioPin
+	doorSerial               *serialDoorSensor // Instead of door, if there's an Arduino door sensor
+	motionSensor             gpioPin           // PIR sensor, if there is one
+	outerBeam, innerBeam     gpioPin           // Break-beams for counting people, if there are any
+	breakButton              gpioPin           // Starts a "back soon" break
+
+	// Owned by the sampler goroutine, which turns debounced readings into events.
+	samplePeriod             time.Duration
+	doorFilter, switchFilter debouncer
+	sampledMotion            bool
+	beams                    beamCounter
+	buttonFilter             debouncer
+	rotaryLast               SwitchState // The last position of the rotary switch that was in the config
+	rotaryUnknownSince       time.Time   // When it went to a position that isn't, zero if it hasn't
+	unavailable              sensorFaults
+	pinErrs                  map[string]sensorFault
+	lastSampledFaults        string
+	sampledOverride          *remoteOverride
+	recorder                 *inputRecorder // Only when config.RecordInputs is set
+	events                   chan inputEvent
+
+	// Owned by the state machine, built up from the events.
+	openFilter    holdFilter
+	doorOpen      bool
+	switchValue   SwitchState
+	rawOpen, open bool
+	openChangedAt time.Time
+	overrideSet   *remoteOverride // As last set through /override, it may have expired
+	override      *remoteOverride
+	motion        bool
+	lastMotion    time.Time
+	occupancyTime time.Duration
+	faults        sensorFaults
+	doorChangedAt time.Time
+	doorStuckTime time.Duration
+	occupancy     int
+	occupancyDay  time.Time
+	capacity      int
+	breakUntil    time.Time
+	breakLength   time.Duration
+	stateFile     string      // Only when running the sign, see persist.go
+	lastSaved     *savedState // What's in stateFile
 }
 
-func (si *SignInput) init() {
-	var err error
+func (si *SignInput) init(c Config) {
+	si.setup(c)
+	http.HandleFunc("/debug/inputs", serveInputDiagnostics)
+	http.HandleFunc("/override", serveOverride)
+	http.HandleFunc("/sensors", serveSensors)
+	if filename := c.RecordInputs; filename != "" {
+		var err error
+		if si.recorder, err = openInputRecorder(filename); err != nil {
+			inputLog.Error("Not recording inputs", "err", err)
+		}
+	}
 
-	si.gpio17, err = hwio.GetPin("gpio17")
-	if si.gpio17 == 0 {
-		fmt.Println("gpio17 ", err)
-	} else {
-		hwio.PinMode(si.gpio17, hwio.INPUT)
+	if !c.Dev {
+		si.stateFile = c.StateFile
+		si.restoreState(timeNow())
 	}
 
-	si.gpio27, err = hwio.GetPin("gpio27")
-	if si.gpio27 == 0 {
-		fmt.Println("gpio27 ", err)
+	setupRemoteNodes(c.Nodes)
+	hw := c.Hardware.withoutRemoteSensors()
+	if len(hw.Rotary.Pins) > 0 {
+		for _, pin := range hw.Rotary.Pins {
+			si.rotary = append(si.rotary, openInputPin(pin))
+		}
+		si.rotaryPositions = make(map[int]SwitchState)
+		for _, position := range hw.Rotary.Positions {
+			si.rotaryPositions[position.Code], _ = switchStateByName(position.Mode)
+		}
 	} else {
-		hwio.PinMode(si.gpio27, hwio.INPUT)
+		si.switchShifts = openInputPin(hw.SwitchShifts)
+		si.switchOpen = openInputPin(hw.SwitchOpen)
 	}
-
-	si.gpio18, err = hwio.GetPin("gpio18")
-	if si.gpio18 == 0 {
-		fmt.Println("gpio18 ", err)
+	if hw.DoorSerial.Device != "" {
+		var err error
+		if si.doorSerial, err = openSerialDoorSensor(hw.DoorSerial); err != nil {
+			inputLog.Error("Failed to open the door sensor", "device", hw.DoorSerial.Device, "err", err)
+		} else {
+			si.doorSerial.spawnReader(si.samplePeriod)
+		}
 	} else {
-		hwio.PinMode(si.gpio18, hwio.INPUT)
+		si.door = openInputPin(hw.Door)
+	}
+	si.motionSensor = openInputPin(hw.Motion)
+	si.outerBeam = openInputPin(hw.OuterBeam)
+	si.innerBeam = openInputPin(hw.InnerBeam)
+	si.breakButton = openInputPin(hw.BreakButton)
+	si.unavailable = findUnavailablePins(hw, si)
+}
+
+// setup Sets up everything but the pins, which is all a replay needs.
+func (si *SignInput) setup(c Config) {
+	si.samplePeriod = duration(c.Inputs.SamplePeriod)
+	si.doorFilter.period = duration(c.Inputs.DoorDebounce)
+	si.switchFilter.period = duration(c.Inputs.SwitchDebounce)
+	si.openFilter.hold = duration(c.Inputs.OpenHold)
+	si.occupancyTime = duration(c.Inputs.OccupancyTime)
+	si.doorStuckTime = duration(c.Inputs.DoorStuckTime)
+	si.pinErrs = make(map[string]sensorFault)
+	si.events = make(chan inputEvent, inputEventBacklog)
+	si.buttonFilter.period = defaultButtonBounce
+	si.breakLength = defaultBreakLength
+	if c.BreakLength != "" {
+		si.breakLength, _ = time.ParseDuration(c.BreakLength) // Already validated
 	}
+	si.capacity = c.Capacity
 }
 
 func (si *SignInput) finish() {
-	if si.gpio17 != 0 {
-		hwio.ClosePin(si.gpio17)
+	si.saveState(timeNow(), true) // So the restart that's probably coming knows how recent it is
+	si.switchShifts.close()
+	si.switchOpen.close()
+	for _, pin := range si.rotary {
+		pin.close()
 	}
-	if si.gpio27 != 0 {
-		hwio.ClosePin(si.gpio27)
+	si.door.close()
+	if si.doorSerial != nil {
+		si.doorSerial.close()
 	}
-	if si.gpio18 != 0 {
-		hwio.ClosePin(si.gpio18)
+	si.motionSensor.close()
+	si.outerBeam.close()
+	si.innerBeam.close()
+	si.breakButton.close()
+	if si.recorder != nil {
+		si.recorder.close()
 	}
 }
 
@@ -57,13 +158,40 @@ const (
 	stateClosedForced                    // 2
 )
 
-// IsOpen Checks whether the DS should currently be open
+// IsOpen Checks whether the DS should currently be open, using the filtered inputs
 func (si *SignInput) IsOpen() (isOpen, isDoorOpen bool) {
-	// Logic to determine if the studio is likely open.
-	isOpen = len(shifts.getMentorsOnDuty()) > 0
-	isDoorOpen = si.IsDoorOpen()
+	return si.open, si.doorOpen
+}
+
+// OpenChangedAt When the input that last changed IsOpen was sampled.
+func (si *SignInput) OpenChangedAt() time.Time {
+	return si.openChangedAt
+}
+
+// ActiveOverride The remote override that is in effect, nil if there isn't one or the switch is forced closed.
+func (si *SignInput) ActiveOverride() *remoteOverride {
+	return si.override
+}
+
+// computeOpen Logic to determine if the studio is likely open. In order of precedence:
+//  1. The switch in forced closed or one of the custom modes, because someone in the room chose it.
+//  2. A break from the break button, which is closed for the same reason.
+//  3. A remote override, which behaves like the switch would so forced open still needs the door open.
+//  4. The switch in forced open.
+//  5. The shifts.
+func computeOpen(mentorsOnDuty, isDoorOpen bool, switchValue SwitchState, onBreak bool, override *remoteOverride) (isOpen bool) {
+	isOpen = mentorsOnDuty
+	if mode := switchValue.customMode(); mode != nil {
+		// Like forced open, the door has to be open too.
+		return mode.Open && isDoorOpen
+	}
+	if onBreak && switchValue != stateClosedForced {
+		return false
+	}
+	if override != nil && switchValue != stateClosedForced {
+		return override.Open && isDoorOpen
+	}
 	// Now check the switch state. This is a DPDT switch with the states I (normal), II (force open), and O (force closed)
-	switchValue := si.GetSwitchValue()
 	if switchValue == stateShifts {
 		// Door open + normally open. If a mentor misses their shift & the door is closed, the sign will say
 		// that the studio is closed.
@@ -79,27 +207,43 @@ func (si *SignInput) IsOpen() (isOpen, isDoorOpen bool) {
 	return
 }
 
-// GetSwitchValue Reads gpio 17,27 to check the state of a DPDT switch.
+// GetSwitchValue The debounced state of the DPDT switch.
 func (si *SignInput) GetSwitchValue() SwitchState {
-	if si.gpio17 != 0 && si.gpio27 != 0 {
+	return si.switchValue
+}
+
+// readSwitchValue Reads the two switch pins to check the state of a DPDT switch.
+func (si *SignInput) readSwitchValue(now time.Time) SwitchState {
+	if hasRemoteSensor("switch") {
+		readings, node, err := readRemoteSensor("switch", now)
+		si.reportPinErr("switch", node, err)
+		if err != nil || readings.Switch == nil {
+			return stateShifts
+		}
+		sv, _ := switchStateByName(*readings.Switch)
+		return sv
+	}
+	if len(si.rotary) > 0 {
+		return si.readRotarySwitch(now)
+	}
+	if si.switchShifts.connected() && si.switchOpen.connected() {
 		// Is this normal open?
-		openOne, err := hwio.DigitalRead(si.gpio17)
+		openOne, err := si.switchShifts.read()
+		si.reportPinErr("switch", si.switchShifts.name, err)
 		if err == nil {
-			if openOne == hwio.HIGH { // It is indeed.
+			if openOne { // It is indeed.
 				return stateShifts
 			}
 			// Is it actually forced open?
-			openTwo, err := hwio.DigitalRead(si.gpio27)
+			openTwo, err := si.switchOpen.read()
+			si.reportPinErr("switch", si.switchOpen.name, err)
 			if err == nil {
-				if openTwo == hwio.HIGH { // It is indeed.
+				if openTwo { // It is indeed.
 					return stateOpenForced
 				}
 				// The only other possibility is forced closed.
 				return stateClosedForced
 			}
-			fmt.Println("gpio27 err ", err)
-		} else {
-			fmt.Println("gpio17 err ", err)
 		}
 	}
 	// This will be returned if there are any errors. There's no way to really recover from fatal errors
@@ -107,31 +251,82 @@ func (si *SignInput) GetSwitchValue() SwitchState {
 	return stateShifts
 }
 
-// IsDoorOpen Checks whether the door is open, using a Reed switch and a magnet connected to the Pi via CAT5e ethernet cable
+// IsDoorOpen The debounced state of the door.
 func (si *SignInput) IsDoorOpen() bool {
-	if si.gpio18 == 0 {
+	return si.doorOpen
+}
+
+// hasDoorSensor Whether there's any sort of door sensor, without one the door is assumed to be open.
+func (si *SignInput) hasDoorSensor() bool {
+	return si.door.connected() || si.doorSerial != nil || hasRemoteSensor("door")
+}
+
+// readDoorOpen Checks whether the door is open, using a Reed switch and a magnet connected to the Pi via CAT5e ethernet cable
+func (si *SignInput) readDoorOpen(now time.Time) bool {
+	if hasRemoteSensor("door") {
+		readings, node, err := readRemoteSensor("door", now)
+		si.reportPinErr("door", node, err)
+		if err != nil || readings.Door == nil {
+			return true
+		}
+		return *readings.Door
+	}
+	if si.doorSerial != nil {
+		result, err := si.doorSerial.read()
+		si.reportPinErr("door", si.doorSerial.device, err)
+		if err != nil {
+			return true
+		}
+		return result
+	}
+	if !si.door.connected() {
 		return true
 	}
-	result, err := hwio.DigitalRead(si.gpio18)
+	result, err := si.door.read()
+	si.reportPinErr("door", si.door.name, err)
 	if err != nil {
 		return true
 	}
-	// If the door is open, sensor will output LOW, else HIGH.
+	// With the default wiring the sensor outputs LOW if the door is open, else HIGH.
 	// If the sensor is disconnected, defaults to LOW which returns the default value.
-	return result == hwio.LOW
+	return result
 }
 
+// IsThereMotion Whether the PIR sensor currently sees someone moving.
 func (si *SignInput) IsThereMotion() bool {
-	// Sensor not installed
-	return false
+	return si.motion
 }
 
-var inputState *SignInput
+// LastMotion When the PIR sensor last saw motion, zero if it never has.
+func (si *SignInput) LastMotion() time.Time {
+	return si.lastMotion
+}
+
+// IsOccupied Guesses whether anyone is in the studio, from whether there's been motion recently.
+func (si *SignInput) IsOccupied(now time.Time) bool {
+	return !si.lastMotion.IsZero() && now.Sub(si.lastMotion) <= si.occupancyTime
+}
 
-var inputFunction = func() moore.InputFunction {
-	inputState = &SignInput{}
-	inputState.init()
-	return func() moore.Input {
-		return inputState
+// readMotion Checks the PIR sensor, which stays active for a few seconds after it sees motion.
+func (si *SignInput) readMotion(now time.Time) bool {
+	if hasRemoteSensor("motion") {
+		readings, node, err := readRemoteSensor("motion", now)
+		si.reportPinErr("motion", node, err)
+		return err == nil && readings.Motion != nil && *readings.Motion
 	}
-}()
+	if !si.motionSensor.connected() {
+		// Sensor not installed
+		return false
+	}
+	result, err := si.motionSensor.read()
+	si.reportPinErr("motion", si.motionSensor.name, err)
+	return err == nil && result
+}
+
+// inputState is set up by main once the config has been loaded.
+var inputState = &SignInput{}
+
+var inputFunction moore.InputFunction = func() moore.Input {
+	inputState.applyEvents(timeNow())
+	return inputState
+}
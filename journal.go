@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalHandler sends the logs straight to the systemd journal, with each attribute as a field of its own, so e.g.
+// `journalctl -u studio-status COMPONENT=input` shows just the inputs.
+type journalHandler struct {
+	conn  *net.UnixConn
+	mutex *sync.Mutex
+	level slog.Leveler
+	attrs []slog.Attr
+	group string // Prefix for the field names, from WithGroup
+}
+
+func newJournalHandler(level slog.Leveler) (*journalHandler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalHandler{conn: conn, mutex: &sync.Mutex{}, level: level}, nil
+}
+
+func (h *journalHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+// Handle Writes r in the journal's native format, one KEY=value per line.
+func (h *journalHandler) Handle(ctx context.Context, r slog.Record) error {
+	var entry bytes.Buffer
+	// journalctl only shows the message, so the attributes go on the end of it as well
+	message := r.Message
+	fields := make(map[string]string)
+	addAttr := func(a slog.Attr) bool {
+		value := a.Value.Resolve().String()
+		message += " " + a.Key + "=" + value
+		fields[journalField(h.group+a.Key)] = value
+		return true
+	}
+	for _, a := range h.attrs {
+		addAttr(a)
+	}
+	r.Attrs(addAttr)
+
+	writeJournalField(&entry, "MESSAGE", message)
+	writeJournalField(&entry, "PRIORITY", journalPriority(r.Level))
+	writeJournalField(&entry, "SYSLOG_IDENTIFIER", "studio_status_go")
+	for name, value := range fields {
+		writeJournalField(&entry, name, value)
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	_, err := h.conn.Write(entry.Bytes())
+	return err
+}
+
+func (h *journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	with := *h
+	with.attrs = append(append([]slog.Attr(nil), h.attrs...), attrs...)
+	return &with
+}
+
+func (h *journalHandler) WithGroup(name string) slog.Handler {
+	with := *h
+	with.group = h.group + name + "_"
+	return &with
+}
+
+// journalPriority The syslog priority for a level.
+func journalPriority(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "3"
+	case level >= slog.LevelWarn:
+		return "4"
+	case level >= slog.LevelInfo:
+		return "6"
+	default:
+		return "7"
+	}
+}
+
+// journalField Makes a field name the journal will take: upper case letters, digits and underscores, not starting
+// with an underscore (those are the journal's own).
+func journalField(key string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, key)
+	if name == "" || name[0] == '_' || unicode.IsDigit(rune(name[0])) {
+		name = "X" + name
+	}
+	return name
+}
+
+// writeJournalField Values with newlines in them have to be sent with their length in front instead of after an =.
+func writeJournalField(w *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		w.WriteString(name + "=" + value + "\n")
+		return
+	}
+	w.WriteString(name + "\n")
+	binary.Write(w, binary.LittleEndian, uint64(len(value)))
+	w.WriteString(value + "\n")
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long everything gets to wind down once the sign is told to stop, before it gives up on them and exits anyway.
+const shutdownTimeout = time.Duration(5 * time.Second)
+
+// rootContext is cancelled when the sign is told to stop. Everything running in the background watches it.
+var rootContext, cancelRoot = context.WithCancel(context.Background())
+
+var (
+	stopOnce     sync.Once
+	stoppedFor   string
+	workers      sync.WaitGroup
+	workersMutex sync.Mutex
+	running      = make(map[string]int) // Names of the workers that haven't returned yet
+)
+
+// stopSign Tells everything to stop. Only the first reason is kept.
+func stopSign(reason string) {
+	stopOnce.Do(func() {
+		workersMutex.Lock()
+		stoppedFor = reason
+		workersMutex.Unlock()
+		cancelRoot()
+	})
+}
+
+// stopReason Why the sign was told to stop, or "" if it hasn't been.
+func stopReason() string {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	return stoppedFor
+}
+
+// spawnWorker Runs work in the background. It should return soon after ctx is done, and waitForWorkers waits for it.
+func spawnWorker(name string, work func(ctx context.Context)) {
+	workers.Add(1)
+	workersMutex.Lock()
+	running[name]++
+	workersMutex.Unlock()
+	go func() {
+		defer workers.Done()
+		defer func() {
+			workersMutex.Lock()
+			if running[name]--; running[name] == 0 {
+				delete(running, name)
+			}
+			workersMutex.Unlock()
+		}()
+		work(rootContext)
+	}()
+}
+
+// waitForWorkers Waits up to timeout for every worker to return, and says which ones didn't.
+func waitForWorkers(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		workersMutex.Lock()
+		var stuck []string
+		for name := range running {
+			stuck = append(stuck, name)
+		}
+		workersMutex.Unlock()
+		sort.Strings(stuck)
+		lifecycleLog.Warn("Gave up waiting", "timeout", timeout, "workers", strings.Join(stuck, ", "))
+		return false
+	}
+}
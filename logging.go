@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The parts of the sign, which every line logged says it came from.
+var (
+	inputLog      = componentLogger("input")
+	signLog       = componentLogger("sign")
+	displayLog    = componentLogger("display")
+	activityLog   = componentLogger("activity")
+	postLog       = componentLogger("post")
+	serverLog     = componentLogger("server")
+	lifecycleLog  = componentLogger("lifecycle")
+	supervisorLog = componentLogger("supervisor")
+)
+
+// logHandler is where everything logged ends up. It's the console until setupLogging has read the config.
+var logHandler atomic.Value
+
+type handlerBox struct{ slog.Handler }
+
+func init() {
+	logHandler.Store(handlerBox{slog.NewTextHandler(os.Stderr, nil)})
+}
+
+// setupLogging Sends the logs where the config says, at its level.
+func setupLogging(c LoggingConfig) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return err
+	}
+	options := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch c.Output {
+	case "console":
+		h = slog.NewTextHandler(os.Stderr, options)
+	case "file":
+		f, err := os.OpenFile(c.File, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		h = slog.NewJSONHandler(f, options)
+	case "journald":
+		var err error
+		if h, err = newJournalHandler(level); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output %q", c.Output)
+	}
+	if window := duration(c.RepeatWindow); window > 0 {
+		h = &repeatLimiter{Handler: h, window: window, repeats: &repeats{last: make(map[string]*repeat)}}
+	}
+	logHandler.Store(handlerBox{h})
+	// So anything using the log package, like the HTTP server, ends up there too
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// componentLogger A logger that adds the component to each line. It looks up logHandler every time, so it can be
+// made before the config is read.
+func componentLogger(component string) *slog.Logger {
+	return slog.New(&componentHandler{attrs: []slog.Attr{slog.String("component", component)}})
+}
+
+type componentHandler struct {
+	attrs []slog.Attr
+}
+
+func (h *componentHandler) current() slog.Handler {
+	return logHandler.Load().(handlerBox).Handler
+}
+
+func (h *componentHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.current().Enabled(ctx, level)
+}
+
+func (h *componentHandler) Handle(ctx context.Context, r slog.Record) error {
+	r.AddAttrs(h.attrs...)
+	return h.current().Handle(ctx, r)
+}
+
+func (h *componentHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &componentHandler{attrs: append(append([]slog.Attr(nil), h.attrs...), attrs...)}
+}
+
+// WithGroup Groups aren't used by the sign, so a grouped logger just sticks with the handler of the moment.
+func (h *componentHandler) WithGroup(name string) slog.Handler {
+	return h.current().WithAttrs(h.attrs).WithGroup(name)
+}
+
+// repeatLimiter drops a warning or error that's the same as one logged less than window ago, and says how many were
+// dropped the next time it gets through. Otherwise something like an unplugged pin would be logged on every sample.
+type repeatLimiter struct {
+	slog.Handler
+	window  time.Duration
+	repeats *repeats // Shared with the loggers made by WithAttrs
+}
+
+type repeats struct {
+	sync.Mutex
+	last map[string]*repeat
+}
+
+type repeat struct {
+	at      time.Time
+	dropped int
+}
+
+// Past this many different lines, the ones that haven't come up within the window are forgotten.
+const maxRepeatsTracked = 1000
+
+func (h *repeatLimiter) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelWarn {
+		return h.Handler.Handle(ctx, r)
+	}
+	var key strings.Builder
+	key.WriteString(r.Level.String() + " " + r.Message)
+	r.Attrs(func(a slog.Attr) bool {
+		key.WriteString(" " + a.String())
+		return true
+	})
+
+	h.repeats.Lock()
+	last := h.repeats.last[key.String()]
+	if last != nil && r.Time.Sub(last.at) < h.window {
+		last.dropped++
+		h.repeats.Unlock()
+		return nil
+	}
+	if len(h.repeats.last) >= maxRepeatsTracked {
+		for k, v := range h.repeats.last {
+			if r.Time.Sub(v.at) >= h.window {
+				delete(h.repeats.last, k)
+			}
+		}
+	}
+	h.repeats.last[key.String()] = &repeat{at: r.Time}
+	h.repeats.Unlock()
+
+	if last != nil && last.dropped > 0 {
+		r.AddAttrs(slog.Int("repeated", last.dropped))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *repeatLimiter) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &repeatLimiter{Handler: h.Handler.WithAttrs(attrs), window: h.window, repeats: h.repeats}
+}
+
+func (h *repeatLimiter) WithGroup(name string) slog.Handler {
+	return &repeatLimiter{Handler: h.Handler.WithGroup(name), window: h.window, repeats: h.repeats}
+}
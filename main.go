@@ -1,63 +1,97 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"strings"
 	"time"
 
-	"github.com/mrmorphic/hwio"
 	"github.com/sameer/fsm/moore"
 	"github.com/veandco/go-sdl2/sdl"
 	"github.com/veandco/go-sdl2/ttf"
 )
 
-const tick = time.Duration(1000 / 22 * time.Millisecond) // convert ticks per second to useful number
-
 type SignState struct {
 	Init           bool
 	BackgroundFill sdl.Color // Background fill
 	Window         *sdl.Window
+	Surface        *sdl.Surface // What's drawn on instead of Window when headless
 	Renderer       *sdl.Renderer
 	Fonts          map[int]*ttf.Font
 	Open           bool
+	OpenChangedAt  time.Time // When the input that last flipped Open was sampled
 	DoorOpen       bool
 	SwitchValue    SwitchState
+	Mode           *ModeConfig // The custom mode the switch is in, if it isn't in one of the usual three
+	BreakUntil     time.Time   // When the mentor on a break from the break button will be back
+	ClosesAt       time.Time   // When the shifts going on now end, zero if there aren't any
 	Motion         bool
+	LastMotion     time.Time
+	Occupied       bool // Motion within the last inputs.occupancyTime
+	Faults         sensorFaults
+	Override       *remoteOverride // Set remotely through /override
+	Occupancy      int             // People counted in by the break-beams
+	Capacity       int
+	Full           bool // Open, but at capacity
+	Phase          SignPhase
+	LastTransition signTransitionEvent // How the sign got into Phase
 	Title          string
 	Subtitle       string
 	LogAndPostChan chan SignState
+	LastSnapshot   time.Time
+
+	relay gpioPin
+}
 
-	gpio22 hwio.Pin
+func (s *SignState) onBreak() bool {
+	return !s.BreakUntil.IsZero()
 }
 
 func initState(s *SignState) (*SignState, error) {
-	// Init to default state
-	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
+	if err := initDisplay(s, sdl.WINDOW_FULLSCREEN|sdl.WINDOW_SHOWN|sdl.WINDOW_BORDERLESS); err != nil {
 		return nil, err
 	}
+	spawnSignalBroadcaster()
+	if !config.Display.Headless {
+		spawnSDLEventWaiter()
+	}
+	spawnInputSampler(inputState)
+	if config.Dev {
+		s.LogAndPostChan = spawnLogAndPost("", false)
+	} else {
+		s.LogAndPostChan = spawnLogAndPost(config.LogFile, true)
+	}
+	spawnStatsPoster()
 
-	if i, err := sdl.ShowCursor(sdl.QUERY); i == sdl.ENABLE && err == nil {
-		sdl.ShowCursor(sdl.DISABLE)
-		if i, err := sdl.ShowCursor(sdl.QUERY); i == sdl.ENABLE && err != nil {
-			fmt.Println("failed to hide cursor")
+	s.relay = openOutputPin(config.Hardware.Relay)
+
+	s.Init = true // Mark as succeeded
+	return s, nil
+}
+
+// initDisplay Opens the window (or an offscreen surface when headless) and fonts and puts the sign in its default
+// state.
+func initDisplay(s *SignState, windowFlags uint32) error {
+	width, height = int32(config.Display.Width), int32(config.Display.Height)
+	if config.Display.Headless {
+		if err := initHeadless(s); err != nil {
+			return err
 		}
+	} else if err := initWindow(s, windowFlags); err != nil {
+		return err
 	}
-	window, rend, err := sdl.CreateWindowAndRenderer(width, height, sdl.WINDOW_FULLSCREEN|sdl.WINDOW_SHOWN|sdl.WINDOW_BORDERLESS)
-	if err != nil {
-		return nil, err
-	}
-	s.Window, s.Renderer = window, rend
 
 	if err := ttf.Init(); err != nil {
-		return nil, err
+		return err
 	}
 	s.Fonts = make(map[int]*ttf.Font)
 	for _, size := range desiredFontSizes {
 		font, err := ttf.OpenFont(font, size)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		font.SetStyle(ttf.STYLE_BOLD)
 		font.SetHinting(ttf.HINTING_MONO)
@@ -72,22 +106,33 @@ func initState(s *SignState) (*SignState, error) {
 	s.Motion = false
 	s.Title = "Closed"
 	s.Subtitle = ""
-	spawnSignalBroadcaster()
-	spawnSDLEventWaiter()
-	s.LogAndPostChan = spawnLogAndPost()
-	spawnStatsPoster()
+	return nil
+}
 
-	if s.gpio22, err = hwio.GetPin("gpio22"); err == nil {
-		hwio.PinMode(s.gpio22, hwio.OUTPUT)
+func initWindow(s *SignState, windowFlags uint32) error {
+	// Init to default state
+	if err := sdl.Init(sdl.INIT_VIDEO); err != nil {
+		return err
 	}
 
-	s.Init = true // Mark as succeeded
-	return s, nil
+	if i, err := sdl.ShowCursor(sdl.QUERY); i == sdl.ENABLE && err == nil {
+		sdl.ShowCursor(sdl.DISABLE)
+		if i, err := sdl.ShowCursor(sdl.QUERY); i == sdl.ENABLE && err != nil {
+			displayLog.Warn("Failed to hide cursor")
+		}
+	}
+	window, rend, err := sdl.CreateWindowAndRenderer(width, height, windowFlags)
+	if err != nil {
+		return err
+	}
+	s.Window, s.Renderer = window, rend
+	return nil
 }
 
 var transitionFunction moore.TransitionFunction = func(state moore.State, input moore.Input) (moore.State, error) {
 	s := state.(*SignState)
 	i := input.(*SignInput)
+	lastTick.Store(time.Now().UnixNano())
 	if !s.Init {
 		if _, err := initState(s); err != nil {
 			return nil, err
@@ -96,50 +141,43 @@ var transitionFunction moore.TransitionFunction = func(state moore.State, input
 
 	// Put inputs into state struct
 	s.Open, s.DoorOpen = i.IsOpen()
+	s.OpenChangedAt = i.OpenChangedAt()
 	s.SwitchValue = i.GetSwitchValue()
+	s.Mode = s.SwitchValue.customMode()
+	s.BreakUntil = i.BreakUntil(timeNow())
+	s.ClosesAt = shifts.getClosingTime(timeNow())
+	s.Override = i.ActiveOverride()
+	s.Occupancy, s.Capacity = i.Occupancy(), config.Capacity
+	s.Full = s.Open && i.IsFull()
 	s.Motion = i.IsThereMotion()
-
-	// State-based handling of tile
-	if s.Open {
-		s.Title = "Open"
-	} else {
-		s.Title = "Closed"
-	}
-
-	// State-based handling of subtitle
-	if s.Open && s.SwitchValue == stateShifts {
-		s.Subtitle = ""
-		for _, mentorShift := range shifts.getMentorsOnDuty() {
-			if s.Subtitle != "" {
-				s.Subtitle += " & "
-			}
-			s.Subtitle += mentorShift.name
-		}
-	} else if !s.Open && s.SwitchValue == stateShifts { // Show when the studio opens next if there are shifts today
-		nextShifts := shifts.getNextMentorsOnDutyToday()
-		if len(shifts.getMentorsOnDuty()) > 0 || len(nextShifts) == 0 {
-			// TODO: How to handle a missed shift in between other shifts?
-			// If there is supposed to be a shift right now and it's closed, we know that the opens at time is probably
-			// wrong so we shouldn't misinform the users. What about a shift that is separated from other shifts? Should
-			// we still say anything if that shift was missed? i.e. the possibility that there is a day where no one is
-			// on duty, due to a school holiday or other reason. For now, we depend upon a mentor to switch the sign to
-			// force closed to indicate that we shouldn't tell anyone when it opens.
-			s.Subtitle = "?"
-		} else if len(nextShifts) > 0 {
-			s.Subtitle = nextShifts[0].time(time.Now().Date()).Format(time.Kitchen)
+	s.LastMotion = i.LastMotion()
+	s.Occupied = i.IsOccupied(timeNow())
+	if faults := i.Faults(timeNow()); faults.String() != s.Faults.String() {
+		if len(faults) > 0 {
+			signLog.Warn("Sensor faults", "faults", faults.String())
 		} else {
-			s.Subtitle = ""
+			signLog.Info("Sensor faults cleared")
 		}
-	} else {
-		s.Subtitle = ""
+		s.Faults = faults
 	}
 
-	if reason := signalStateStr.Load(); reason != "" {
-		fmt.Print("Gracefully shutting down because of \"", reason, "\"...")
-		if s.gpio22 != 0 {
-			hwio.ClosePin(s.gpio22)
+	s.updatePhase(timeNow())
+	s.Title, s.Subtitle = s.phaseTitle(), s.phaseSubtitle()
+
+	if reason := stopReason(); reason != "" {
+		lifecycleLog.Info("Gracefully shutting down", "reason", reason)
+		if s.relay.connected() {
+			s.relay.write(false) // Don't leave the open sign on
+		}
+		s.relay.close()
+		// Before the pins are closed, so the sampler isn't reading them, and so the log is flushed
+		waitForWorkers(shutdownTimeout)
+		if s.Window != nil {
+			s.Window.Destroy()
+		} else {
+			s.Renderer.Destroy()
+			s.Surface.Free()
 		}
-		s.Window.Destroy()
 		for _, font := range s.Fonts {
 			font.Close()
 		}
@@ -150,13 +188,45 @@ var transitionFunction moore.TransitionFunction = func(state moore.State, input
 		inputState.finish()
 		ttf.Quit()
 		sdl.Quit()
-		fmt.Println("done!")
+		lifecycleLog.Info("Shut down")
 		return nil, nil
 	}
 	return s, nil
 }
 
 func main() {
+	name, args := "run", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		printUsage()
+		return
+	}
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args); err != nil {
+				lifecycleLog.Error("Command failed", "command", name, "err", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Println("Unknown command", name)
+	printUsage()
+	os.Exit(2)
+}
+
+// runSign Runs the sign until it's told to stop.
+func runSign(args []string) error {
+	flags := commandFlags("run")
+	dev := flags.Bool("dev", false, "same as -set dev=true")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	config.Dev = config.Dev || *dev
+	inputState.init(config)
+
 	mm := moore.Make(
 		&SignState{},
 		nil,
@@ -164,14 +234,33 @@ func main() {
 		inputFunction,
 		outputFunction,
 	)
-	if os.Getenv("DEV") != "" {
-		go func() {
-			http.ListenAndServe("localhost:6060", nil)
-		}()
-	} else {
+	http.HandleFunc("/debug/posts", servePostMetrics)
+	spawnServer(config.serverAddress())
+	spawnHeartbeat()
+	err := mm.Run(time.NewTicker(config.tick()))
+	// If it stopped because of an error, the workers haven't been told to yet
+	stopSign("the sign stopped")
+	waitForWorkers(shutdownTimeout)
+	return err
+}
+
+// spawnServer Serves /debug and /override on addr until the sign stops.
+func spawnServer(addr string) {
+	server := &http.Server{Addr: addr}
+	spawnWorker("server", func(ctx context.Context) {
+		errs := make(chan error, 1)
 		go func() {
-			http.ListenAndServe("0.0.0.0:6060", nil)
+			errs <- server.ListenAndServe()
 		}()
-	}
-	mm.Run(time.NewTicker(tick))
+		select {
+		case err := <-errs:
+			serverLog.Error("Failed to serve", "addr", addr, "err", err)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				serverLog.Error("Failed to stop the server", "err", err)
+			}
+		}
+	})
 }
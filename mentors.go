@@ -53,7 +53,7 @@ var shifts = mentorShifts{
 }
 
 func (ms mentorShifts) getMentorsOnDuty() (mentorsOnDuty []mentorShift) {
-	return ms.getShiftsAtTime(time.Now())
+	return ms.getShiftsAtTime(timeNow())
 }
 
 func (ms mentorShifts) getShiftsAtTime(t time.Time) (shifts []mentorShift) {
@@ -87,7 +87,7 @@ func (ms mentorShifts) getShiftsAfterTime(t time.Time) (shifts []mentorShift) {
 }
 
 func (ms mentorShifts) getNextMentorsOnDutyToday() (shifts []mentorShift) {
-	now := time.Now()
+	now := timeNow()
 	for _, shift := range ms.getShiftsAfterTime(now) {
 		shiftStart := shift.time(now.Date())
 		shifts = ms.getShiftsAtTime(shiftStart)
@@ -95,3 +95,22 @@ func (ms mentorShifts) getNextMentorsOnDutyToday() (shifts []mentorShift) {
 	}
 	return
 }
+
+// getClosingTime When the shifts t is in end. Shifts that overlap or follow straight on from each other are merged,
+// so it's when the studio closes rather than when the current mentor leaves. Zero if t isn't in a shift.
+func (ms mentorShifts) getClosingTime(t time.Time) time.Time {
+	if len(ms.getShiftsAtTime(t)) == 0 {
+		return time.Time{}
+	}
+	end := t
+	for extended := true; extended; {
+		extended = false
+		for _, shift := range ms.getShiftsOnWeekday(t.Weekday()) {
+			shiftStart := shift.time(t.Date())
+			if shiftEnd := shiftStart.Add(shift.duration); !shiftStart.After(end) && shiftEnd.After(end) {
+				end, extended = shiftEnd, true
+			}
+		}
+	}
+	return end
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetClosingTime(t *testing.T) {
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2019, 2, day, hour, min, 0, 0, time.Local)
+	}
+	for _, test := range []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"a shift on its own", at(12, 13, 0), at(12, 14, 0)},                // Tuesday
+		{"shifts that overlap and follow on", at(12, 17, 0), at(12, 22, 0)}, // 16-18, 17-19, 18-20, 20-22
+		{"right at the start", at(12, 16, 0), at(12, 22, 0)},
+		{"a minute before the end", at(12, 21, 59), at(12, 22, 0)},
+		{"between shifts", at(12, 15, 0), time.Time{}},
+		{"right at the end", at(12, 22, 0), time.Time{}},
+		{"half past start", at(14, 15, 0), at(14, 22, 0)},  // Thursday from 14:30
+		{"no shifts that day", at(16, 15, 0), time.Time{}}, // Saturday
+	} {
+		if got := shifts.getClosingTime(test.t); !got.Equal(test.want) {
+			t.Errorf("%v: closes at %v, want %v", test.name, got, test.want)
+		}
+	}
+}
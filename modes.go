@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Custom modes from the config are numbered after the built in switch states, so SwitchState(3) is config.Modes[0].
+const stateCustomBase SwitchState = stateClosedForced + 1
+
+// modeColors are the backgrounds a custom mode can have. They're the road sign colors that white text is readable on.
+var modeColors = map[string]sdl.Color{
+	"blue":   blue,
+	"green":  green,
+	"purple": purple,
+	"black":  black,
+	"brown":  brown,
+	"red":    red,
+}
+
+// builtinModes are the names for the three positions the DPDT switch has.
+var builtinModes = map[string]SwitchState{
+	"shifts": stateShifts,
+	"open":   stateOpenForced,
+	"closed": stateClosedForced,
+}
+
+// customMode The mode from the config for a switch state, or nil if it's one of the built in ones.
+func (sv SwitchState) customMode() *ModeConfig {
+	i := int(sv - stateCustomBase)
+	if i < 0 || i >= len(config.Modes) {
+		return nil
+	}
+	return &config.Modes[i]
+}
+
+// name What the config calls a switch state, the opposite of switchStateByName.
+func (sv SwitchState) name() string {
+	for name, builtin := range builtinModes {
+		if sv == builtin {
+			return name
+		}
+	}
+	if mode := sv.customMode(); mode != nil {
+		return mode.Name
+	}
+	return ""
+}
+
+// switchStateByName Finds a built in or custom mode by name.
+func switchStateByName(name string) (SwitchState, bool) {
+	if sv, ok := builtinModes[name]; ok {
+		return sv, true
+	}
+	for i, mode := range config.Modes {
+		if mode.Name == name {
+			return stateCustomBase + SwitchState(i), true
+		}
+	}
+	return stateShifts, false
+}
+
+// readRotarySwitch Reads the rotary switch's position as a binary code, with the first pin as the lowest bit.
+func (si *SignInput) readRotarySwitch(now time.Time) SwitchState {
+	code := 0
+	for i, pin := range si.rotary {
+		if !pin.connected() { // Already a fault
+			return stateShifts
+		}
+		active, err := pin.read()
+		si.reportPinErr("switch", pin.name, err)
+		if err != nil {
+			return stateShifts
+		}
+		if active {
+			code |= 1 << uint(i)
+		}
+	}
+	sv, ok := si.rotaryPositions[code]
+	if !ok {
+		// Most likely in between two positions, so it stays where it was. If it stays here for longer than the
+		// switch debounce, something is wrong with the wiring or the config.
+		if si.rotaryUnknownSince.IsZero() {
+			si.rotaryUnknownSince = now
+		}
+		if now.Sub(si.rotaryUnknownSince) < si.switchFilter.period {
+			return si.rotaryLast
+		}
+		si.reportPinErr("switch", "rotary", fmt.Errorf("position %v isn't in the config", code))
+		return stateShifts
+	}
+	si.rotaryUnknownSince = time.Time{}
+	si.reportPinErr("switch", "rotary", nil)
+	si.rotaryLast = sv
+	return sv
+}
+
+func validateModes(modes []ModeConfig) error {
+	names := make(map[string]bool)
+	for i, mode := range modes {
+		if mode.Name == "" {
+			return fmt.Errorf("modes[%v]: needs a name", i)
+		}
+		if _, ok := builtinModes[mode.Name]; ok || names[mode.Name] {
+			return fmt.Errorf("modes[%v]: there's already a mode called %v", i, mode.Name)
+		}
+		names[mode.Name] = true
+		if mode.Title == "" {
+			return fmt.Errorf("modes[%v]: needs a title", i)
+		}
+		if _, ok := modeColors[mode.Color]; !ok {
+			return fmt.Errorf("modes[%v]: color should be one of blue, green, purple, black, brown or red", i)
+		}
+	}
+	return nil
+}
+
+func validateRotary(r RotaryConfig, modes []ModeConfig) error {
+	if len(r.Pins) == 0 {
+		return nil
+	}
+	if len(r.Pins) > 8 {
+		return fmt.Errorf("hardware.rotary: can have at most 8 pins")
+	}
+	codes := make(map[int]bool)
+	for i, position := range r.Positions {
+		if position.Code < 0 || position.Code >= 1<<uint(len(r.Pins)) {
+			return fmt.Errorf("hardware.rotary.positions[%v]: code %v can't be made with %v pins", i, position.Code, len(r.Pins))
+		}
+		if codes[position.Code] {
+			return fmt.Errorf("hardware.rotary.positions[%v]: code %v is already used", i, position.Code)
+		}
+		codes[position.Code] = true
+		found := false
+		if _, ok := builtinModes[position.Mode]; ok {
+			found = true
+		}
+		for _, mode := range modes {
+			found = found || mode.Name == position.Mode
+		}
+		if !found {
+			return fmt.Errorf("hardware.rotary.positions[%v]: there's no mode called %q", i, position.Mode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import "time"
+
+// beamCrossingTimeout is how long someone can stand between the beams before the crossing is forgotten.
+const beamCrossingTimeout = time.Duration(5 * time.Second)
+
+// beamCounter works out which way people go through the door from the order they break two beams in. Someone
+// coming in breaks the outer beam first and clears the inner one last, someone leaving does the opposite. If they
+// clear the beam they started at last, they turned back, even if they got as far as the other one, and nothing is
+// counted.
+type beamCounter struct {
+	first   beam // Which beam was broken first, or beamNone
+	last    beam // Which beam was last broken on its own
+	started time.Time
+}
+
+type beam int
+
+const (
+	beamNone beam = iota
+	beamOuter
+	beamInner
+)
+
+// update Returns +1 when someone has come in, -1 when someone has left, else 0.
+func (bc *beamCounter) update(outer, inner bool, now time.Time) (delta int) {
+	if bc.first != beamNone && now.Sub(bc.started) > beamCrossingTimeout {
+		bc.first = beamNone
+	}
+	switch bc.first {
+	case beamNone:
+		if outer && !inner {
+			bc.first, bc.last, bc.started = beamOuter, beamOuter, now
+		} else if inner && !outer {
+			bc.first, bc.last, bc.started = beamInner, beamInner, now
+		}
+		// Both at once can't tell us a direction, so wait for them to clear.
+	default:
+		if outer && !inner {
+			bc.last = beamOuter
+		} else if inner && !outer {
+			bc.last = beamInner
+		}
+		if !outer && !inner { // All the way through, or turned back
+			if bc.first == beamOuter && bc.last == beamInner {
+				delta = 1
+			} else if bc.first == beamInner && bc.last == beamOuter {
+				delta = -1
+			}
+			bc.first = beamNone
+		}
+	}
+	return
+}
+
+// readBeams Reads the break-beam pair, which are active while the beam is broken.
+func (si *SignInput) readBeams() (outer, inner bool) {
+	if !si.outerBeam.connected() || !si.innerBeam.connected() {
+		return false, false
+	}
+	outer, err := si.outerBeam.read()
+	si.reportPinErr("beam", si.outerBeam.name, err)
+	if err != nil {
+		return false, false
+	}
+	inner, err = si.innerBeam.read()
+	si.reportPinErr("beam", si.innerBeam.name, err)
+	if err != nil {
+		return false, false
+	}
+	return outer, inner
+}
+
+// countOccupant Applies someone coming in or going out. Missed crossings would otherwise build up forever, so the
+// count can't go below zero and starts over every day.
+func (si *SignInput) countOccupant(delta int, t time.Time) {
+	si.resetOccupancyDaily(t)
+	si.occupancy += delta
+	if si.occupancy < 0 {
+		si.occupancy = 0
+	}
+}
+
+func (si *SignInput) resetOccupancyDaily(t time.Time) {
+	if y, m, d := t.Date(); si.occupancyDay.IsZero() || y != si.occupancyDay.Year() || m != si.occupancyDay.Month() || d != si.occupancyDay.Day() {
+		si.occupancy, si.occupancyDay = 0, t
+	}
+}
+
+// Occupancy How many people the beams have counted in the studio today.
+func (si *SignInput) Occupancy() int {
+	return si.occupancy
+}
+
+// IsFull Whether the studio is at capacity. A capacity of 0 means there's no limit.
+func (si *SignInput) IsFull() bool {
+	return si.capacity > 0 && si.occupancy >= si.capacity
+}
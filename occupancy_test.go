@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBeamCounter(t *testing.T) {
+	start := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	type reading struct {
+		after        time.Duration
+		outer, inner bool
+	}
+	for _, test := range []struct {
+		name      string
+		readings  []reading
+		wantDelta int
+	}{
+		{"coming in", []reading{{0, true, false}, {100 * time.Millisecond, true, true}, {200 * time.Millisecond, false, true}, {300 * time.Millisecond, false, false}}, 1},
+		{"going out", []reading{{0, false, true}, {100 * time.Millisecond, true, true}, {200 * time.Millisecond, true, false}, {300 * time.Millisecond, false, false}}, -1},
+		{"turned back", []reading{{0, true, false}, {100 * time.Millisecond, false, false}}, 0},
+		{"reached the inner beam and turned back", []reading{{0, true, false}, {100 * time.Millisecond, true, true}, {200 * time.Millisecond, true, false}, {300 * time.Millisecond, false, false}}, 0},
+		{"reached the outer beam and went back in", []reading{{0, false, true}, {100 * time.Millisecond, true, true}, {200 * time.Millisecond, false, true}, {300 * time.Millisecond, false, false}}, 0},
+		{"both at once", []reading{{0, true, true}, {100 * time.Millisecond, false, false}}, 0},
+		{"stood between the beams too long", []reading{{0, true, false}, {time.Second, true, true}, {beamCrossingTimeout + time.Second, false, false}}, 0},
+		{"two people in", []reading{
+			{0, true, false}, {100 * time.Millisecond, false, true}, {200 * time.Millisecond, false, false},
+			{time.Second, true, false}, {1100 * time.Millisecond, false, true}, {1200 * time.Millisecond, false, false},
+		}, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var bc beamCounter
+			delta := 0
+			for _, r := range test.readings {
+				delta += bc.update(r.outer, r.inner, start.Add(r.after))
+			}
+			if delta != test.wantDelta {
+				t.Errorf("counted %v, want %v", delta, test.wantDelta)
+			}
+		})
+	}
+}
@@ -2,197 +2,235 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
-	"sync/atomic"
 	"syscall"
 	"time"
 
-	"github.com/mrmorphic/hwio"
 	"github.com/sameer/fsm/moore"
 	studio_statistics "github.com/vanderbilt-design-studio/studio-statistics"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
-var signalStateStr atomic.Value
-
 func spawnSignalBroadcaster() {
 	signalChan := make(chan os.Signal, 2)
 	signal.Notify(signalChan, os.Kill, os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
-	signalStateStr.Store("")
-	go func() {
-		signalListenTicker := time.NewTicker(time.Millisecond * 50)
-		for signalStateStr.Load() == "" || signalStateStr.Load() == nil {
-			<-signalListenTicker.C
-			select {
-			case v := <-signalChan:
-				signalStateStr.Store(v.String())
-			default:
-				continue
-			}
+	spawnWorker("signals", func(ctx context.Context) {
+		// Once it's stopping, a second Ctrl-C kills it straight away
+		defer signal.Stop(signalChan)
+		select {
+		case v := <-signalChan:
+			stopSign(v.String())
+		case <-ctx.Done():
 		}
-	}()
+	})
 }
 
 func spawnSDLEventWaiter() {
-	go func() {
-		for signalStateStr.Load() == "" || signalStateStr.Load() == nil {
+	spawnWorker("SDL events", func(ctx context.Context) {
+		for ctx.Err() == nil {
 			event := sdl.WaitEventTimeout(50)
 			switch event.(type) {
 			case *sdl.QuitEvent:
-				signalStateStr.Store("SDL quit event issued")
+				stopSign("SDL quit event issued")
 			case *sdl.KeyboardEvent:
 				if ke := event.(*sdl.KeyboardEvent); ke.Keysym.Sym == sdl.K_ESCAPE || ke.Keysym.Sym == sdl.K_q {
-					signalStateStr.Store("SDL keypress quit event issued")
+					stopSign("SDL keypress quit event issued")
 				}
 			}
 		}
-	}()
+	})
 }
 
-const postURL = "https://ds-sign.yunyul.in"
-const logFilename = "activity.log"
-
-func spawnLogAndPost() chan SignState {
+// spawnLogAndPost Logs the state to filename and its details log, unless it's empty, and posts it if shouldPost.
+// With the v2 post.format, transitions are queued to be posted even if the network is down. When the sign stops, the
+// last state is logged and the files are synced before it returns.
+func spawnLogAndPost(filename string, shouldPost bool) chan SignState {
 	const logAndPostPeriod = time.Duration(1 * time.Second)
 	c := make(chan SignState)
-	go func(stateChannel chan SignState) {
-		isDev := os.Getenv("DEV") != ""
+	spawnWorker("log and post", func(ctx context.Context) {
 		tick := time.NewTicker(logAndPostPeriod)
-		logFile, err := os.OpenFile(logFilename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
-		shouldLog := !isDev
-		if err != nil {
-			fmt.Println(err)
-			shouldLog = false
-		} else {
-			defer logFile.Close()
+		defer tick.Stop()
+		var logFile, detailFile *os.File
+		shouldLog := filename != ""
+		if shouldLog {
+			var err error
+			if logFile, err = os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600); err != nil {
+				activityLog.Error("Not logging", "err", err)
+				shouldLog = false
+			} else if detailFile, err = os.OpenFile(detailLogName(filename), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600); err != nil {
+				activityLog.Error("Not logging", "err", err)
+				logFile.Close()
+				shouldLog = false
+			}
 		}
-		for signalStateStr.Load() == "" || signalStateStr.Load() == nil {
-			state := <-stateChannel
+		var poster *statusPoster
+		if shouldPost {
+			poster = spawnStatusPoster()
+		}
+		var state SignState
+		var received bool
+		var lastLoggedChange, lastTransition, lastLogged time.Time
+		// A transition can come in after a tick that's later than when it happened. Lines never go back in time,
+		// since the statistics read the log in order, so then it's logged at the tick's time instead.
+		logAt := func(t time.Time) error {
+			if t.Before(lastLogged) {
+				t = lastLogged
+			}
+			lastLogged = t
+			return state.logAt(logFile, detailFile, t)
+		}
+		for {
 			select {
+			case state = <-c:
+				received = true
+				// Transitions are logged straight away with the time the input changed, rather than waiting for the
+				// next tick, so the statistics get precise opening and closing times.
+				if shouldLog && state.OpenChangedAt != lastLoggedChange {
+					logAt(state.OpenChangedAt)
+					lastLoggedChange = state.OpenChangedAt
+				}
+				if poster != nil && !state.LastTransition.Time.Equal(lastTransition) {
+					if body, err := json.Marshal(state.statusPayload(state.LastTransition.Time)); err != nil {
+						postLog.Error("Failed to encode post", "err", err)
+					} else if config.Post.Format == "v2" {
+						poster.enqueue(state.LastTransition.Time, body)
+					} else {
+						// A legacy post doesn't say when it's from, so one posted late would look current. It's
+						// only posted if it gets through in time.
+						poster.setLatest(body)
+					}
+					lastTransition = state.LastTransition.Time
+				}
 			case <-tick.C:
-				if !isDev {
-					state.Post()
+				if !received {
+					continue
+				}
+				if poster != nil {
+					if body, err := json.Marshal(state.statusPayload(timeNow())); err != nil {
+						postLog.Error("Failed to encode post", "err", err)
+					} else {
+						poster.setLatest(body)
+					}
 				}
 				if shouldLog {
-					state.Log(logFile)
+					logAt(timeNow())
 				}
-			default:
-				continue
+			case <-ctx.Done():
+				if shouldLog {
+					if received {
+						if err := logAt(timeNow()); err != nil {
+							activityLog.Error("Failed to log the last state", "err", err)
+						}
+					}
+					for _, f := range []*os.File{logFile, detailFile} {
+						if err := f.Sync(); err != nil {
+							activityLog.Error("Failed to sync", "file", f.Name(), "err", err)
+						}
+						f.Close()
+					}
+				}
+				return
 			}
 		}
-	}(c)
+	})
 	return c
 }
 
+// statsPostingEnabled The statistics graph isn't posted for now, the poster just waits to be stopped.
+const statsPostingEnabled = false
+
 func spawnStatsPoster() {
 	const statsPostPeriod = time.Duration(2 * time.Minute)
-	go func() {
+	spawnWorker("stats poster", func(ctx context.Context) {
 		tick := time.NewTicker(statsPostPeriod)
-		for range tick.C {
-			continue
-			fmt.Println("Beginning post...")
-			xAPIKey := os.Getenv("x_api_key")
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return
+			}
+			if !statsPostingEnabled {
+				continue
+			}
+			postLog.Debug("Beginning stats post")
+			xAPIKey := config.Post.APIKey
 			if xAPIKey == "" {
-				fmt.Println("No api key, continuing")
+				postLog.Debug("No api key, not posting stats")
 				continue
 			}
-			if os.Getenv("DEV") != "" {
-				fmt.Println("Dev env, continuing")
+			if config.Dev {
+				postLog.Debug("Dev env, not posting stats")
 				continue
 			}
-			fmt.Println("Reading file")
-			content, err := ioutil.ReadFile(logFilename)
+			postLog.Debug("Reading activity log")
+			content, err := ioutil.ReadFile(config.LogFile)
 			if err != nil {
-				fmt.Println("Error in accessing file:", err)
+				postLog.Error("Failed to read the activity log", "err", err)
 				continue
 			}
 			var buf bytes.Buffer
-			fmt.Println("Making graph")
+			postLog.Debug("Making graph")
 			if err := studio_statistics.MakeGraph(bytes.NewReader(content), &buf); err != nil {
-				fmt.Println("Error in trying to make graph", err)
+				postLog.Error("Failed to make graph", "err", err)
 			}
-			req, err := http.NewRequest("POST", "http://spuri.io/studio-statistics.png", &buf)
+			req, err := http.NewRequest("POST", config.Post.StatsURL, &buf)
 			if err != nil {
-				fmt.Println("Failed to prepare post request:", err)
+				postLog.Error("Failed to prepare stats post", "err", err)
 				continue
 			}
 			req.Header.Add("content-type", "image/png")
 			req.Header.Add("content-length", strconv.Itoa(buf.Len()))
 			req.Header.Add("x-api-key", xAPIKey)
-			if _, err := http.DefaultClient.Do(req); err != nil {
-				fmt.Println("Error in trying to post data", err)
+			resp, err := postClient.Do(req.WithContext(ctx))
+			if err != nil {
+				postLog.Error("Failed to post stats", "err", err)
+				continue
 			}
-			fmt.Println("Stats posted with size", buf.Len())
-		}
-	}()
-}
-
-func (s *SignState) Post() {
-	xAPIKey := os.Getenv("x_api_key")
-	if xAPIKey == "" {
-		return
-	}
-
-	// TODO: grab mentor on duty
-	if s.Subtitle != "" { // There is a subtitle
-		if !s.Open && s.SwitchValue == stateShifts { // whetherOpens text
-			if s.Subtitle == "?" { // Unknown studio dynamics from whetherOpen
-				s.Subtitle = ""
-			} else if _, err := time.Parse(s.Subtitle, time.Kitchen); err != nil { // Put opens at time
-				s.Subtitle = whetherOpensOpenAt + s.Subtitle
-			} else { // This should never be the case, but who knows -- might as well be safe
-				s.Subtitle = ""
+			resp.Body.Close()
+			if resp.StatusCode < 200 || resp.StatusCode > 299 {
+				postLog.Error("Failed to post stats", "status", resp.Status)
+				continue
 			}
-		} else {
-			s.Subtitle = makePluralHandlingMentorString(s.Subtitle, false) + s.Subtitle
+			postLog.Info("Stats posted", "size", buf.Len())
 		}
-	} else if !s.Open && s.SwitchValue == stateShifts {
-		s.Subtitle = whetherOpensNotOpen
-	}
-	payload := strings.NewReader(fmt.Sprintf(`{"bgColor": "rgb(%v,%v,%v)", "title": "%v", "subtitle": "%v"}`,
-		s.BackgroundFill.R, s.BackgroundFill.G, s.BackgroundFill.B,
-		s.Title,
-		s.Subtitle,
-	))
-
-	req, err := http.NewRequest("POST", postURL, payload)
-	if err != nil {
-		fmt.Println("Failed to prepare post request:", err)
-		return
-	}
-
-	req.Header.Add("content-type", "application/json")
-	req.Header.Add("x-api-key", xAPIKey)
-
-	_, err = http.DefaultClient.Do(req)
-	if err != nil {
-		fmt.Println("Failed to post data:", err)
-	}
+	})
 }
 
-func (s *SignState) Log(w io.Writer) error {
-	csvLine := fmt.Sprintf("%v,%v,%v,%v\n", time.Now().Format(time.RFC3339Nano), s.Open, s.SwitchValue, s.Motion)
-	if _, err := w.Write([]byte(csvLine)); err != nil {
+// logAt Writes the four columns studio_statistics.MakeGraph reads to w, and the same line with the fault, occupancy
+// and break columns after them to details.
+func (s *SignState) logAt(w, details io.Writer, t time.Time) error {
+	csvLine := fmt.Sprintf("%v,%v,%v,%v", t.Format(time.RFC3339Nano), s.Open, s.SwitchValue, s.Motion)
+	if _, err := fmt.Fprintln(w, csvLine); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(details, "%v,%v,%v,%v\n", csvLine, len(s.Faults) > 0, s.Occupancy, s.onBreak()); err != nil {
 		return err
 	}
 	return nil
 }
 
+// detailLogName Where the details log for the activity log filename goes, e.g. activity-details.log next to
+// activity.log.
+func detailLogName(filename string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "-details" + ext
+}
+
 // DoRelay Make the open sign above the door reflect the state of the sign.
 func (s *SignState) DoRelay() {
-	if s.gpio22 != 0 {
-		if s.Open {
-			hwio.DigitalWrite(s.gpio22, hwio.HIGH)
-		} else {
-			hwio.DigitalWrite(s.gpio22, hwio.LOW)
-		}
+	if s.relay.connected() {
+		s.relay.write(s.relayOn())
 	}
 }
 
@@ -202,6 +240,9 @@ var outputFunction moore.OutputFunction = func(state moore.State) {
 	}
 	s := state.(*SignState)
 	s.draw() // Do draw commands
-	s.LogAndPostChan <- *s
+	select {
+	case s.LogAndPostChan <- *s:
+	case <-rootContext.Done(): // It's stopped listening
+	}
 	s.DoRelay()
 }
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// remoteOverride forces the sign open or closed from the API until it expires, for when nobody can get to the
+// switch. See computeOpen for how it combines with the switch.
+type remoteOverride struct {
+	Open   bool      `json:"open"`
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason,omitempty"` // Shown on the sign, e.g. "Closed for event setup"
+}
+
+// overrideRequest is what gets POSTed to /override. Either Until or For has to be given.
+type overrideRequest struct {
+	Open   bool      `json:"open"`
+	Until  time.Time `json:"until"`
+	For    string    `json:"for"` // A duration like "90m"
+	Reason string    `json:"reason"`
+}
+
+const maxOverrideReasonLength = 40 // Any longer and it runs off the sign
+
+var currentOverride *remoteOverride
+var overrideLock sync.Mutex
+
+// activeOverride The override at time t, or nil if there isn't one or it has expired.
+func activeOverride(t time.Time) *remoteOverride {
+	return latestOverride().activeAt(t)
+}
+
+// latestOverride The override as it was last set, even if it has expired since.
+func latestOverride() *remoteOverride {
+	overrideLock.Lock()
+	defer overrideLock.Unlock()
+	if currentOverride == nil {
+		return nil
+	}
+	o := *currentOverride
+	return &o
+}
+
+// activeAt The override if it hasn't expired by time t, else nil.
+func (o *remoteOverride) activeAt(t time.Time) *remoteOverride {
+	if o == nil || !t.Before(o.Until) {
+		return nil
+	}
+	return o
+}
+
+func sameOverride(a, b *remoteOverride) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Open == b.Open && a.Until.Equal(b.Until) && a.Reason == b.Reason
+}
+
+func setOverride(o *remoteOverride) {
+	overrideLock.Lock()
+	currentOverride = o
+	overrideLock.Unlock()
+	if o == nil {
+		inputLog.Info("Remote override cleared")
+	} else {
+		inputLog.Info("Remote override", "override", o.String())
+	}
+}
+
+func (o *remoteOverride) String() string {
+	state := "closed"
+	if o.Open {
+		state = "open"
+	}
+	str := state + " until " + untilString(o.Until, timeNow())
+	if o.Reason != "" {
+		str = o.Reason + " (" + str + ")"
+	}
+	return str
+}
+
+// untilString t as a time of day, with the day in front if it isn't today.
+func untilString(t, now time.Time) string {
+	ty, tm, td := t.Date()
+	ny, nm, nd := now.Date()
+	switch {
+	case ty == ny && tm == nm && td == nd:
+		return t.Format(time.Kitchen)
+	case t.Sub(now) < 6*24*time.Hour:
+		return t.Format("Mon " + time.Kitchen)
+	}
+	return t.Format("Mon Jan 2 " + time.Kitchen)
+}
+
+// isAuthorized Checks the request has server.overrideKey as its x-api-key. Without one set, nobody is.
+func isAuthorized(r *http.Request) bool {
+	xAPIKey := config.Server.OverrideKey
+	return xAPIKey != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("x-api-key")), []byte(xAPIKey)) == 1
+}
+
+// serveOverride GET shows the current override, POST sets one, DELETE clears it.
+func serveOverride(w http.ResponseWriter, r *http.Request) {
+	if !isAuthorized(r) {
+		http.Error(w, "missing or wrong x-api-key", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req overrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		o := &remoteOverride{Open: req.Open, Until: req.Until, Reason: req.Reason}
+		if req.For != "" {
+			d, err := time.ParseDuration(req.For)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			o.Until = now.Add(d)
+		}
+		if !o.Until.After(now) {
+			http.Error(w, "override needs an until or for in the future", http.StatusBadRequest)
+			return
+		}
+		if len(o.Reason) > maxOverrideReasonLength {
+			http.Error(w, fmt.Sprintf("reason can be at most %v characters", maxOverrideReasonLength), http.StatusBadRequest)
+			return
+		}
+		setOverride(o)
+	case http.MethodDelete:
+		setOverride(nil)
+	default:
+		w.Header().Set("allow", "GET, POST, DELETE")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(activeOverride(time.Now()))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// The sign only picks up where it left off being open or closed if it was saved this recently. After longer than
+// that, it's better to wait for the inputs than to trust what it was.
+const restoreOpenWithin = time.Duration(2 * time.Minute)
+
+// The state is saved at least this often even if nothing has changed, so saved says the sign was still running then.
+// It has to be well within restoreOpenWithin.
+const stateRefreshPeriod = time.Duration(1 * time.Minute)
+
+// savedState is what's kept in config.StateFile so a restart doesn't lose breaks, overrides or the people counted
+// in, and the sign doesn't flash Closed while the inputs settle.
+type savedState struct {
+	Saved        time.Time       `json:"saved"`
+	Open         bool            `json:"open"`
+	DoorOpen     bool            `json:"doorOpen"`
+	Switch       string          `json:"switch"`
+	BreakUntil   time.Time       `json:"breakUntil"`
+	Override     *remoteOverride `json:"override"`
+	Occupancy    int             `json:"occupancy"`
+	OccupancyDay time.Time       `json:"occupancyDay"`
+	LastMotion   time.Time       `json:"lastMotion"` // To the minute, so constant motion isn't saved on every tick
+}
+
+// same Whether two saved states are the same, apart from when they were saved.
+func (a savedState) same(b savedState) bool {
+	return a.Open == b.Open && a.DoorOpen == b.DoorOpen && a.Switch == b.Switch && a.BreakUntil.Equal(b.BreakUntil) &&
+		sameOverride(a.Override, b.Override) && a.Occupancy == b.Occupancy && a.OccupancyDay.Equal(b.OccupancyDay) &&
+		a.LastMotion.Equal(b.LastMotion)
+}
+
+func (si *SignInput) savedState(now time.Time) savedState {
+	return savedState{
+		Saved:        now,
+		Open:         si.open,
+		DoorOpen:     si.doorOpen,
+		Switch:       si.switchValue.name(),
+		BreakUntil:   si.breakUntil,
+		Override:     si.overrideSet,
+		Occupancy:    si.occupancy,
+		OccupancyDay: si.occupancyDay,
+		LastMotion:   si.lastMotion.Truncate(time.Minute),
+	}
+}
+
+// saveState Writes the state to config.StateFile if it has changed since it was last written, it's been
+// stateRefreshPeriod since then, or force is set.
+func (si *SignInput) saveState(now time.Time, force bool) {
+	if si.stateFile == "" {
+		return
+	}
+	state := si.savedState(now)
+	if !force && si.lastSaved != nil && si.lastSaved.same(state) && now.Sub(si.lastSaved.Saved) < stateRefreshPeriod {
+		return
+	}
+	err := writeFileAtomically(si.stateFile, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(state)
+	})
+	if err != nil {
+		inputLog.Error("Failed to save the sign's state", "file", si.stateFile, "err", err)
+		return
+	}
+	si.lastSaved = &state
+}
+
+// restoreState Picks up from the saved state, leaving out anything that has expired since.
+func (si *SignInput) restoreState(now time.Time) {
+	if si.stateFile == "" {
+		return
+	}
+	content, err := os.ReadFile(si.stateFile)
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		inputLog.Error("Failed to read the sign's saved state", "file", si.stateFile, "err", err)
+		return
+	}
+	var state savedState
+	if err := json.Unmarshal(content, &state); err != nil {
+		inputLog.Error("Ignoring the sign's saved state", "file", si.stateFile, "err", err)
+		return
+	}
+
+	restored := []interface{}{"saved", state.Saved.Format(time.RFC3339)}
+	if now.Before(state.BreakUntil) {
+		si.breakUntil = state.BreakUntil
+		restored = append(restored, "breakUntil", si.breakUntil.Format(time.Kitchen))
+	}
+	if o := state.Override.activeAt(now); o != nil {
+		// The sampler picks it up from here like any other override
+		overrideLock.Lock()
+		currentOverride = o
+		overrideLock.Unlock()
+		si.overrideSet = o
+		restored = append(restored, "override", o.String())
+	}
+	si.occupancy, si.occupancyDay = state.Occupancy, state.OccupancyDay
+	si.resetOccupancyDaily(now) // Yesterday's count doesn't carry over
+	si.lastMotion = state.LastMotion
+	restored = append(restored, "occupancy", si.occupancy)
+
+	// Seeding the filters means the sign goes straight back to what it was showing instead of Closed, and the
+	// readings take over from there as usual.
+	if age := now.Sub(state.Saved); age >= 0 && age <= restoreOpenWithin {
+		si.doorOpen = state.DoorOpen
+		if sv, ok := switchStateByName(state.Switch); ok {
+			si.switchValue = sv
+		}
+		si.open, si.openChangedAt = state.Open, now
+		si.openFilter.value, si.openFilter.changed, si.openFilter.started = state.Open, now, true
+		restored = append(restored, "open", si.open)
+	}
+	inputLog.Info("Restored the sign's state", restored...)
+	saved := si.savedState(now)
+	si.lastSaved = &saved
+}
+
+// writeFileAtomically Writes a file next to filename first and then moves it over filename, so nothing reading it
+// ever sees half of it, even if the sign stops part way through.
+func writeFileAtomically(filename string, write func(w io.Writer) error) error {
+	f, err := os.Create(filepath.Join(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp"))
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), filename)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestState(t *testing.T, state savedState) string {
+	filename := filepath.Join(t.TempDir(), "state.json")
+	content, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestRestoreState(t *testing.T) {
+	defer setOverride(nil)
+	now := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	for _, test := range []struct {
+		name          string
+		state         savedState
+		wantSeeded    bool // Whether the open state was picked up, open or not
+		wantOpen      bool
+		wantBreak     time.Time
+		wantOverride  bool
+		wantOccupancy int
+	}{
+		{
+			name: "just restarted",
+			state: savedState{Saved: now.Add(-time.Minute), Open: true, DoorOpen: true, Switch: "shifts",
+				BreakUntil: now.Add(5 * time.Minute), Override: &remoteOverride{Open: true, Until: now.Add(time.Hour)},
+				Occupancy: 4, OccupancyDay: now.Add(-time.Hour)},
+			wantSeeded:    true,
+			wantOpen:      true,
+			wantBreak:     now.Add(5 * time.Minute),
+			wantOverride:  true,
+			wantOccupancy: 4,
+		},
+		{
+			name: "down too long to trust open",
+			state: savedState{Saved: now.Add(-restoreOpenWithin - time.Second), Open: true, DoorOpen: true,
+				Switch: "shifts", Occupancy: 4, OccupancyDay: now.Add(-time.Hour)},
+			wantOpen:      false,
+			wantOccupancy: 4,
+		},
+		{
+			name: "break and override ran out",
+			state: savedState{Saved: now.Add(-time.Hour), BreakUntil: now.Add(-time.Minute),
+				Override: &remoteOverride{Open: false, Until: now}},
+		},
+		{
+			name:       "yesterday's count",
+			state:      savedState{Saved: now.Add(-time.Minute), Occupancy: 4, OccupancyDay: now.AddDate(0, 0, -1)},
+			wantSeeded: true,
+		},
+		{
+			name:     "saved in the future",
+			state:    savedState{Saved: now.Add(time.Minute), Open: true, DoorOpen: true, Switch: "shifts"},
+			wantOpen: false,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			setOverride(nil)
+			si := &SignInput{stateFile: writeTestState(t, test.state)}
+			si.restoreState(now)
+			if si.open != test.wantOpen || si.openFilter.started != test.wantSeeded {
+				t.Errorf("open %v and open filter started %v, want %v and %v", si.open, si.openFilter.started, test.wantOpen, test.wantSeeded)
+			}
+			if !si.breakUntil.Equal(test.wantBreak) {
+				t.Errorf("break until %v, want %v", si.breakUntil, test.wantBreak)
+			}
+			if (si.overrideSet != nil) != test.wantOverride || (latestOverride() != nil) != test.wantOverride {
+				t.Errorf("override %v, want one: %v", si.overrideSet, test.wantOverride)
+			}
+			if si.occupancy != test.wantOccupancy {
+				t.Errorf("occupancy %v, want %v", si.occupancy, test.wantOccupancy)
+			}
+		})
+	}
+}
+
+func TestRestoreStateMissingOrBroken(t *testing.T) {
+	now := time.Now()
+	si := &SignInput{stateFile: filepath.Join(t.TempDir(), "state.json")}
+	si.restoreState(now)
+	if si.open || si.lastSaved != nil {
+		t.Errorf("restored something from a file that isn't there")
+	}
+	if err := os.WriteFile(si.stateFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	si.restoreState(now)
+	if si.open || si.lastSaved != nil {
+		t.Errorf("restored something from a broken file")
+	}
+}
+
+func TestSaveStateRefreshes(t *testing.T) {
+	si := &SignInput{stateFile: filepath.Join(t.TempDir(), "state.json")}
+	start := time.Date(2019, 2, 12, 15, 0, 0, 0, time.Local)
+	saved := func() time.Time {
+		content, err := os.ReadFile(si.stateFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var state savedState
+		if err := json.Unmarshal(content, &state); err != nil {
+			t.Fatal(err)
+		}
+		return state.Saved
+	}
+
+	for _, step := range []struct {
+		after     time.Duration
+		force     bool
+		wantSaved time.Duration
+	}{
+		{0, false, 0},
+		{30 * time.Second, false, 0}, // Nothing changed
+		{stateRefreshPeriod, false, stateRefreshPeriod},
+		{stateRefreshPeriod + time.Second, true, stateRefreshPeriod + time.Second}, // Stopping
+	} {
+		si.saveState(start.Add(step.after), step.force)
+		if got := saved(); !got.Equal(start.Add(step.wantSaved)) {
+			t.Errorf("after %v: saved at %v, want %v", step.after, got, start.Add(step.wantSaved))
+		}
+	}
+
+	si.occupancy++
+	si.saveState(start.Add(stateRefreshPeriod+2*time.Second), false)
+	if got := saved(); !got.Equal(start.Add(stateRefreshPeriod + 2*time.Second)) {
+		t.Errorf("not saved straight away after a change")
+	}
+}
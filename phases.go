@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SignPhase is what the sign is doing as a whole, worked out from the inputs by signPhaseRules. Unlike the rest of
+// SignState, it's something a person would say, like "forced closed" or "open, but closing soon".
+type SignPhase int
+
+const (
+	phaseStarting       SignPhase = iota // Before the first tick
+	phaseOpenShift                       // Open because there's a shift and the door is open
+	phaseOpenForced                      // Open because of the switch or a remote override
+	phaseClosingSoon                     // Open, but the shifts are about to end
+	phaseClosedDoorShut                  // It would be open, but the door is shut
+	phaseClosedForced                    // Closed because of the switch or a remote override
+	phaseClosedOffShift                  // Nobody is on shift
+	phaseBreak                           // The mentor on duty stepped out
+	phaseFull                            // Open, but at capacity
+	phaseMode                            // One of the custom modes from the config
+	phaseFault                           // The door or switch can't be trusted, so the sign is a best guess
+)
+
+var signPhaseNames = map[SignPhase]string{
+	phaseStarting:       "Starting",
+	phaseOpenShift:      "OpenShift",
+	phaseOpenForced:     "OpenForced",
+	phaseClosingSoon:    "ClosingSoon",
+	phaseClosedDoorShut: "ClosedDoorShut",
+	phaseClosedForced:   "ClosedForced",
+	phaseClosedOffShift: "ClosedOffShift",
+	phaseBreak:          "Break",
+	phaseFull:           "Full",
+	phaseMode:           "Mode",
+	phaseFault:          "Fault",
+}
+
+func (p SignPhase) String() string {
+	if name, ok := signPhaseNames[p]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// signPhaseRule puts the sign in phase to when the guard says so. If from isn't empty, the rule only applies while
+// the sign is already in one of those phases.
+type signPhaseRule struct {
+	from   []SignPhase
+	to     SignPhase
+	reason string
+	guard  func(s *SignState, now time.Time) bool
+}
+
+// signPhaseRules are a priority list rather than a table of transitions: they're checked in order and the first one
+// that applies decides the phase, so the phases that trump the others come first.
+var signPhaseRules = []signPhaseRule{
+	{nil, phaseFull, "at capacity", func(s *SignState, now time.Time) bool {
+		return s.Full
+	}},
+	{nil, phaseClosedForced, "switch is forced closed", func(s *SignState, now time.Time) bool {
+		return s.SwitchValue == stateClosedForced
+	}},
+	{nil, phaseMode, "switch is in a custom mode", func(s *SignState, now time.Time) bool {
+		return s.Mode != nil
+	}},
+	{nil, phaseBreak, "break button pressed", func(s *SignState, now time.Time) bool {
+		return s.onBreak()
+	}},
+	{nil, phaseFault, "door or switch sensor fault", func(s *SignState, now time.Time) bool {
+		for _, sensor := range s.Faults.sensors() {
+			if sensor == "door" || sensor == "switch" {
+				return true
+			}
+		}
+		return false
+	}},
+	{nil, phaseClosedForced, "closed remotely", func(s *SignState, now time.Time) bool {
+		return s.Override != nil && !s.Override.Open
+	}},
+	{nil, phaseOpenForced, "switch is forced open", func(s *SignState, now time.Time) bool {
+		return s.Open && s.SwitchValue == stateOpenForced
+	}},
+	{nil, phaseOpenForced, "opened remotely", func(s *SignState, now time.Time) bool {
+		return s.Open && s.Override != nil
+	}},
+	{[]SignPhase{phaseOpenShift, phaseClosingSoon}, phaseClosingSoon, "shifts are about to end", func(s *SignState, now time.Time) bool {
+		return s.Open && !s.ClosesAt.IsZero() && s.ClosesAt.Sub(now) <= config.closingSoonWindow()
+	}},
+	{nil, phaseOpenShift, "door opened during a shift", func(s *SignState, now time.Time) bool {
+		return s.Open
+	}},
+	{nil, phaseClosedDoorShut, "door shut", func(s *SignState, now time.Time) bool {
+		return !s.DoorOpen && (s.SwitchValue == stateOpenForced || s.Override != nil ||
+			len(shifts.getShiftsAtTime(now)) > 0)
+	}},
+	{nil, phaseClosedOffShift, "no shift", func(s *SignState, now time.Time) bool {
+		return true
+	}},
+}
+
+// signPhaseHook runs when the sign enters or leaves a phase.
+type signPhaseHook struct {
+	onEntry, onExit func(s *SignState)
+}
+
+var signPhaseHooks = map[SignPhase]signPhaseHook{
+	phaseFault: {
+		onEntry: func(s *SignState) {
+			signLog.Warn("Can't trust the " + strings.Join(s.Faults.sensors(), " and ") + " sensor, the sign is a best guess")
+		},
+		onExit: func(s *SignState) {
+			signLog.Info("Sensors can be trusted again")
+		},
+	},
+}
+
+// signTransitionEvent says what the sign changed from and to, and why.
+type signTransitionEvent struct {
+	Time     time.Time
+	From, To SignPhase
+	Reason   string
+}
+
+func (e signTransitionEvent) String() string {
+	return fmt.Sprintf("%v -> %v (%v)", e.From, e.To, e.Reason)
+}
+
+// signTransitionListeners are told about every transition, e.g. to log it.
+var signTransitionListeners = []func(e signTransitionEvent){
+	func(e signTransitionEvent) {
+		signLog.Info("Sign changed", "from", e.From.String(), "to", e.To.String(), "reason", e.Reason)
+	},
+}
+
+// updatePhase Follows the first rule in signPhaseRules that applies, running the hooks and telling the listeners if
+// the phase changes.
+func (s *SignState) updatePhase(now time.Time) {
+	for _, t := range signPhaseRules {
+		if !t.appliesIn(s.Phase) || !t.guard(s, now) {
+			continue
+		}
+		if t.to == s.Phase {
+			return
+		}
+		e := signTransitionEvent{Time: now, From: s.Phase, To: t.to, Reason: t.reason}
+		if hook := signPhaseHooks[s.Phase].onExit; hook != nil {
+			hook(s)
+		}
+		s.Phase, s.LastTransition = t.to, e
+		if hook := signPhaseHooks[s.Phase].onEntry; hook != nil {
+			hook(s)
+		}
+		for _, listener := range signTransitionListeners {
+			listener(e)
+		}
+		return
+	}
+}
+
+func (t signPhaseRule) appliesIn(phase SignPhase) bool {
+	if len(t.from) == 0 {
+		return true
+	}
+	for _, from := range t.from {
+		if from == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// phaseTitle The big text for the current phase.
+func (s *SignState) phaseTitle() string {
+	switch s.Phase {
+	case phaseFull:
+		return "Full"
+	case phaseMode:
+		return s.Mode.Title
+	case phaseBreak:
+		return breakTitle
+	case phaseOpenShift, phaseOpenForced, phaseClosingSoon:
+		return "Open"
+	case phaseFault:
+		// Best guess
+		if s.Open {
+			return "Open"
+		}
+	}
+	return "Closed"
+}
+
+// phaseOpen Whether the current phase is an open one, for the background and the open sign above the door, which
+// shouldn't say open under a "Closed" title while the open state is still being held. Custom modes and faults go by
+// the inputs.
+func (s *SignState) phaseOpen() bool {
+	switch s.Phase {
+	case phaseOpenShift, phaseOpenForced, phaseClosingSoon, phaseFull:
+		return true
+	case phaseMode:
+		return s.Open && s.Mode.Open
+	case phaseFault:
+		return s.Open
+	}
+	return false
+}
+
+// phaseSubtitle The text under the title for the current phase.
+func (s *SignState) phaseSubtitle() string {
+	switch s.Phase {
+	case phaseFull:
+		return fullPleaseWait
+	case phaseMode:
+		return s.Mode.Subtitle
+	case phaseBreak:
+		return fmt.Sprintf(breakBackAtStrf, s.BreakUntil.Format(time.Kitchen))
+	case phaseClosingSoon:
+		return fmt.Sprintf(closingInStrf, s.minutesUntilClosing())
+	}
+	if s.Override != nil {
+		return s.Override.String()
+	}
+	if s.SwitchValue != stateShifts {
+		return ""
+	}
+	if s.Open {
+		subtitle := ""
+		for _, mentorShift := range shifts.getMentorsOnDuty() {
+			if subtitle != "" {
+				subtitle += " & "
+			}
+			subtitle += mentorShift.name
+		}
+		return subtitle
+	}
+	// Show when the studio opens next if there are shifts today
+	nextShifts := shifts.getNextMentorsOnDutyToday()
+	if len(shifts.getMentorsOnDuty()) > 0 || len(nextShifts) == 0 {
+		// TODO: How to handle a missed shift in between other shifts?
+		// If there is supposed to be a shift right now and it's closed, we know that the opens at time is probably
+		// wrong so we shouldn't misinform the users. What about a shift that is separated from other shifts? Should
+		// we still say anything if that shift was missed? i.e. the possibility that there is a day where no one is
+		// on duty, due to a school holiday or other reason. For now, we depend upon a mentor to switch the sign to
+		// force closed to indicate that we shouldn't tell anyone when it opens.
+		return "?"
+	}
+	return nextShifts[0].time(timeNow().Date()).Format(time.Kitchen)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/mrmorphic/hwio"
+)
+
+// gpioPin is a pin opened from a PinConfig, with the polarity taken care of so callers only deal with active or
+// not. The zero value is an unconnected pin.
+type gpioPin struct {
+	name      string
+	pin       hwio.Pin
+	activeLow bool
+}
+
+func openInputPin(c PinConfig) gpioPin {
+	mode := hwio.INPUT
+	switch c.Pull {
+	case "up":
+		mode = hwio.INPUT_PULLUP
+	case "down":
+		mode = hwio.INPUT_PULLDOWN
+	}
+	return openPin(c, mode)
+}
+
+func openOutputPin(c PinConfig) gpioPin {
+	return openPin(c, hwio.OUTPUT)
+}
+
+func openPin(c PinConfig, mode hwio.PinIOMode) gpioPin {
+	if c.Pin == "" {
+		return gpioPin{}
+	}
+	pin, err := hwio.GetPin(c.Pin)
+	if pin == 0 {
+		inputLog.Error("Failed to open pin", "pin", c.Pin, "err", err)
+		return gpioPin{}
+	}
+	if err := hwio.PinMode(pin, mode); err != nil {
+		inputLog.Error("Failed to set pin mode", "pin", c.Pin, "err", err)
+	}
+	return gpioPin{c.Pin, pin, c.ActiveLow}
+}
+
+func (p gpioPin) connected() bool {
+	return p.pin != 0
+}
+
+func (p gpioPin) read() (active bool, err error) {
+	value, err := hwio.DigitalRead(p.pin)
+	if err != nil {
+		return false, err
+	}
+	return (value == hwio.HIGH) != p.activeLow, nil
+}
+
+func (p gpioPin) write(active bool) error {
+	value := hwio.LOW
+	if active != p.activeLow {
+		value = hwio.HIGH
+	}
+	return hwio.DigitalWrite(p.pin, value)
+}
+
+func (p gpioPin) close() {
+	if p.connected() {
+		hwio.ClosePin(p.pin)
+	}
+}
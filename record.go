@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// replayClock is the time in a replay or simulation, which follows the samples instead of the wall clock. It's
+// read by the log and post worker and the server too, so it's only ever swapped whole.
+var replayClock atomic.Pointer[time.Time]
+
+// timeNow What the sign thinks the time is. It's time.Now, except in a replay where the clock follows the recording
+// instead.
+func timeNow() time.Time {
+	if t := replayClock.Load(); t != nil {
+		return *t
+	}
+	return time.Now()
+}
+
+// setReplayClock Moves the clock timeNow returns to t.
+func setReplayClock(t time.Time) {
+	replayClock.Store(&t)
+}
+
+// inputSample is one reading of every input by the sampler. Custom modes in Switch are numbered by the config, so a
+// recording should be replayed with the same config it was made with.
+type inputSample struct {
+	Time     time.Time       `json:"t"`
+	Door     bool            `json:"door"`
+	Switch   SwitchState     `json:"switch"`
+	Motion   bool            `json:"motion"`
+	Outer    bool            `json:"outer,omitempty"`
+	Inner    bool            `json:"inner,omitempty"`
+	Button   bool            `json:"button,omitempty"`
+	Override *remoteOverride `json:"override,omitempty"`
+	Faults   sensorFaults    `json:"faults,omitempty"`
+}
+
+// sameReadings Whether two samples read the same, whenever they were taken.
+func (s inputSample) sameReadings(other inputSample) bool {
+	return s.Door == other.Door && s.Switch == other.Switch && s.Motion == other.Motion &&
+		s.Outer == other.Outer && s.Inner == other.Inner && s.Button == other.Button &&
+		sameOverride(s.Override, other.Override) && s.Faults.String() == other.Faults.String()
+}
+
+// inputRecorder writes the input samples to a file as a JSON line each. Samples that read the same as the one before
+// are left out, since the sampler runs 20 times a second by default and most of the time nothing changes. A replay
+// fills them back in.
+type inputRecorder struct {
+	file    *os.File
+	encoder *json.Encoder
+	last    *inputSample
+}
+
+func openInputRecorder(filename string) (*inputRecorder, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &inputRecorder{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+func (r *inputRecorder) record(sample inputSample) {
+	if r.last != nil && r.last.sameReadings(sample) {
+		return
+	}
+	if err := r.encoder.Encode(sample); err != nil {
+		inputLog.Error("Failed to record inputs", "err", err)
+		return
+	}
+	r.last = &sample
+}
+
+func (r *inputRecorder) close() {
+	r.file.Close()
+}
+
+// readRecording Reads back the samples written by an inputRecorder.
+func readRecording(filename string) ([]inputSample, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var samples []inputSample
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		var sample inputSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			return nil, fmt.Errorf("%v:%v: %v", filename, line, err)
+		}
+		if len(samples) > 0 && sample.Time.Before(samples[len(samples)-1].Time) {
+			return nil, fmt.Errorf("%v:%v: goes back in time", filename, line)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
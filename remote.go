@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const defaultNodeTimeout = time.Duration(30 * time.Second)
+
+// remoteNode is a sensor board (e.g. an ESP by the door) that POSTs its readings to /sensors instead of being
+// wired to the Pi. Each POST doubles as a heartbeat, and a node that goes quiet for longer than its timeout is a
+// fault for every sensor it provides.
+type remoteNode struct {
+	name     string
+	key      string
+	sensors  map[string]bool
+	timeout  time.Duration
+	lastSeen time.Time
+	readings nodeReadings
+}
+
+// nodeReadings is what a node POSTs. Sensors the node doesn't have are left out.
+type nodeReadings struct {
+	Node   string  `json:"node"`
+	Door   *bool   `json:"door,omitempty"` // true if open
+	Switch *string `json:"switch,omitempty"`
+	Motion *bool   `json:"motion,omitempty"`
+}
+
+var remoteNodes = make(map[string]*remoteNode)
+var remoteNodeBySensor = make(map[string]*remoteNode)
+var remoteNodesLock sync.Mutex
+
+func setupRemoteNodes(nodes []RemoteNodeConfig) {
+	remoteNodesLock.Lock()
+	defer remoteNodesLock.Unlock()
+	for _, c := range nodes {
+		node := &remoteNode{name: c.Name, key: c.Key, sensors: make(map[string]bool), timeout: defaultNodeTimeout}
+		if c.Timeout != "" {
+			node.timeout, _ = time.ParseDuration(c.Timeout) // Already validated
+		}
+		for _, sensor := range c.Sensors {
+			node.sensors[sensor] = true
+			remoteNodeBySensor[sensor] = node
+		}
+		remoteNodes[c.Name] = node
+	}
+}
+
+// hasRemoteSensor Whether a node provides the sensor, in which case it's used instead of any pins.
+func hasRemoteSensor(sensor string) bool {
+	remoteNodesLock.Lock()
+	defer remoteNodesLock.Unlock()
+	return remoteNodeBySensor[sensor] != nil
+}
+
+// readRemoteSensor The latest reading from whichever node provides sensor, which is a fault if the node has gone
+// quiet.
+func readRemoteSensor(sensor string, now time.Time) (nodeReadings, string, error) {
+	remoteNodesLock.Lock()
+	defer remoteNodesLock.Unlock()
+	node := remoteNodeBySensor[sensor]
+	name := "node " + node.name
+	if node.lastSeen.IsZero() {
+		return node.readings, name, fmt.Errorf("hasn't been heard from")
+	}
+	if now.Sub(node.lastSeen) > node.timeout {
+		return node.readings, name, fmt.Errorf("silent for more than %v", node.timeout)
+	}
+	return node.readings, name, nil
+}
+
+// withoutRemoteSensors Leaves out the pins for sensors a node provides, so they aren't opened or checked.
+func (h HardwareConfig) withoutRemoteSensors() HardwareConfig {
+	if hasRemoteSensor("door") {
+		h.Door, h.DoorSerial.Device = PinConfig{}, ""
+	}
+	if hasRemoteSensor("switch") {
+		h.SwitchShifts, h.SwitchOpen, h.Rotary.Pins = PinConfig{}, PinConfig{}, nil
+	}
+	if hasRemoteSensor("motion") {
+		h.Motion = PinConfig{}
+	}
+	return h
+}
+
+func serveSensors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var readings nodeReadings
+	if err := json.NewDecoder(r.Body).Decode(&readings); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	remoteNodesLock.Lock()
+	defer remoteNodesLock.Unlock()
+	node := remoteNodes[readings.Node]
+	if node == nil || subtle.ConstantTimeCompare([]byte(r.Header.Get("x-api-key")), []byte(node.key)) != 1 {
+		http.Error(w, "unknown node or wrong x-api-key", http.StatusUnauthorized)
+		return
+	}
+	if readings.Switch != nil {
+		if _, ok := switchStateByName(*readings.Switch); !ok {
+			http.Error(w, "switch should be shifts, open, closed or one of the modes in the config", http.StatusBadRequest)
+			return
+		}
+	}
+	// Keep whatever the node left out from last time, a heartbeat can be just {"node": "..."}.
+	if readings.Door != nil && node.sensors["door"] {
+		node.readings.Door = readings.Door
+	}
+	if readings.Switch != nil && node.sensors["switch"] {
+		node.readings.Switch = readings.Switch
+	}
+	if readings.Motion != nil && node.sensors["motion"] {
+		node.readings.Motion = readings.Motion
+	}
+	node.lastSeen = timeNow() // The same clock the samples are taken on
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validateRemoteNodes(nodes []RemoteNodeConfig) error {
+	names := make(map[string]bool)
+	providedBy := make(map[string]string)
+	for i, node := range nodes {
+		if node.Name == "" {
+			return fmt.Errorf("nodes[%v]: needs a name", i)
+		}
+		if names[node.Name] {
+			return fmt.Errorf("nodes[%v]: there's already a node called %v", i, node.Name)
+		}
+		names[node.Name] = true
+		if node.Key == "" {
+			return fmt.Errorf("nodes[%v]: needs a key", i)
+		}
+		if node.Timeout != "" {
+			if d, err := time.ParseDuration(node.Timeout); err != nil || d <= 0 {
+				return fmt.Errorf("nodes[%v]: timeout should be a duration like \"30s\"", i)
+			}
+		}
+		for _, sensor := range node.Sensors {
+			switch sensor {
+			case "door", "switch", "motion":
+			default:
+				return fmt.Errorf("nodes[%v]: sensors can be door, switch or motion, not %q", i, sensor)
+			}
+			if other, ok := providedBy[sensor]; ok {
+				return fmt.Errorf("nodes[%v]: %v is already provided by %v", i, sensor, other)
+			}
+			providedBy[sensor] = node.Name
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// How long the inputs are played for before showing the sign, so the debouncing and the open hold have settled.
+const renderSettleTime = time.Duration(10 * time.Second)
+
+// render Shows the sign as it would look at a time with the given inputs, in a window, without any pins. It's for
+// trying out a change to the config or the drawing code. With -png it draws offscreen and saves the picture instead.
+func render(args []string) error {
+	flags := commandFlags("render")
+	at := flags.String("at", "", "the time on the sign, like 2019-02-12T14:00:00-06:00, now if empty")
+	door := flags.String("door", "open", "open or closed")
+	switchValue := flags.String("switch", "shifts", "shifts, open, closed or one of the modes in the config")
+	motion := flags.Bool("motion", false, "whether there's motion")
+	pngFile := flags.String("png", "", "save the sign to this PNG and exit, without a window")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	sample, err := renderSample(*at, *door, *switchValue, *motion)
+	if err != nil {
+		return err
+	}
+
+	if *pngFile != "" {
+		config.Display.Headless = true
+		config.Display.SnapshotFile = "" // Only the one picture
+	}
+	inputState.setup(config)
+	state := &SignState{}
+	if err := initDisplay(state, sdl.WINDOW_SHOWN); err != nil {
+		return err
+	}
+	spawnSignalBroadcaster()
+	if !config.Display.Headless {
+		spawnSDLEventWaiter()
+	}
+	state.Init = true
+	if err := settle(sample, state); err != nil {
+		return err
+	}
+	if *pngFile != "" {
+		state.compose()
+		err = state.writeSnapshot(*pngFile)
+		state.Renderer.Present()
+		stopSign("done")
+		if _, cleanupErr := transitionFunction(state, inputFunction()); err == nil {
+			err = cleanupErr
+		}
+		return err
+	}
+	// The clock stays where it was put
+	for stopReason() == "" {
+		state.draw()
+		time.Sleep(config.tick())
+	}
+	_, err = transitionFunction(state, inputFunction())
+	return err
+}
+
+// renderSample The sample for the inputs given to render.
+func renderSample(at, door, switchValue string, motion bool) (inputSample, error) {
+	sample := inputSample{Time: time.Now(), Motion: motion}
+	if at != "" {
+		var err error
+		if sample.Time, err = time.Parse(time.RFC3339, at); err != nil {
+			return sample, fmt.Errorf("at: %v", err)
+		}
+		sample.Time = sample.Time.Local() // The shifts are in local time
+	}
+	switch door {
+	case "open":
+		sample.Door = true
+	case "closed":
+	default:
+		return sample, fmt.Errorf("door should be open or closed")
+	}
+	var ok bool
+	if sample.Switch, ok = switchStateByName(switchValue); !ok {
+		return sample, fmt.Errorf("switch should be shifts, open, closed or one of the modes in the config")
+	}
+	return sample, nil
+}
+
+// settle Plays sample from a little before its time up to it, leaving the clock at its time.
+func settle(sample inputSample, state *SignState) error {
+	until := sample.Time
+	sample.Time = until.Add(-renderSettleTime)
+	return playSamples([]inputSample{sample}, until, config.tick(), state, func(s *SignState) bool {
+		return true
+	})
+}
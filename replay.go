@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// replay Plays a recording made with recordInputs back through the state machine and onto a window, with the clock
+// following the recording, so whatever the sign did overnight can be watched again on a laptop. The same recording
+// always plays back the same way.
+func replay(args []string) error {
+	flags := commandFlags("replay")
+	speed := flags.Float64("speed", 1, "how many times faster than real time to play back, 0 for as fast as possible")
+	logTo := flags.String("log", "replay.log", "where to write the activity log for the replay, empty for nowhere")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: replay [-speed 1] [-log replay.log] recording")
+	}
+	if *speed < 0 {
+		return fmt.Errorf("speed can't be negative")
+	}
+	samples, err := readRecording(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(samples) == 0 {
+		return fmt.Errorf("%v has no samples", flags.Arg(0))
+	}
+
+	inputState.setup(config)
+	state := &SignState{}
+	if err := initDisplay(state, sdl.WINDOW_SHOWN); err != nil {
+		return err
+	}
+	spawnSignalBroadcaster()
+	spawnSDLEventWaiter()
+	state.LogAndPostChan = spawnLogAndPost(*logTo, false)
+	state.Init = true
+
+	end := samples[len(samples)-1].Time
+	if err := playSamples(samples, end, config.tick(), state, func(s *SignState) bool {
+		outputFunction(s)
+		if *speed > 0 {
+			time.Sleep(time.Duration(float64(config.tick()) / *speed))
+		}
+		return true
+	}); err != nil {
+		return err
+	}
+	if stopReason() != "" { // Quit part way through
+		return nil
+	}
+	fmt.Println("Replay reached the end of the recording at", end.Format(time.RFC3339))
+	stopSign("end of recording")
+	_, err = transitionFunction(state, inputFunction())
+	return err
+}
+
+// playSamples Feeds samples through the input filters and the state machine a tick at a time until the time until,
+// with the clock following along. Each tick moves the clock on by step, which is config.tick() to do what the sign
+// would. Between samples the last one is repeated every sample period, just like the sampler would have seen it.
+// After each tick, output gets the new state and can return false to stop early.
+func playSamples(samples []inputSample, until time.Time, step time.Duration, state *SignState,
+	output func(s *SignState) bool) error {
+	now := samples[0].Time
+	next, current := 0, samples[0]
+	sampledUntil := now.Add(-inputState.samplePeriod)
+	for !now.After(until) {
+		setReplayClock(now)
+		for t := sampledUntil.Add(inputState.samplePeriod); !t.After(now); t = t.Add(inputState.samplePeriod) {
+			for next < len(samples) && !samples[next].Time.After(t) {
+				current = samples[next]
+				next++
+			}
+			current.Time = t
+			inputState.processSample(current)
+			sampledUntil = t
+			if len(inputState.events) > inputEventBacklog/2 { // A long step can see more changes than fit
+				inputState.applyEvents(t)
+			}
+		}
+		nextState, err := transitionFunction(state, inputFunction())
+		if err != nil {
+			return err
+		}
+		if nextState == nil { // Quit
+			return nil
+		}
+		if !output(nextState.(*SignState)) {
+			return nil
+		}
+		now = now.Add(step)
+	}
+	return nil
+}
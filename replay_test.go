@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestPlaySamplesLogsInReplayTime Plays a recording with the log worker running alongside, like replay does, and
+// checks every line is logged at a time in the recording, in order. Run it with -race to check the clock is shared
+// safely.
+func TestPlaySamplesLogsInReplayTime(t *testing.T) {
+	t.Cleanup(func() {
+		replayClock.Store(nil)
+		inputState = &SignInput{}
+	})
+	inputState = &SignInput{}
+	inputState.setup(defaultConfig())
+	filename := filepath.Join(t.TempDir(), "replay.log")
+	state := &SignState{Init: true, LogAndPostChan: spawnLogAndPost(filename, false)}
+
+	start := time.Date(2019, 2, 12, 16, 30, 0, 0, time.Local) // In a Tuesday shift
+	samples := []inputSample{
+		{Time: start, Switch: stateShifts},
+		{Time: start.Add(5 * time.Second), Door: true, Switch: stateShifts},
+		{Time: start.Add(15 * time.Second), Switch: stateShifts},
+	}
+	until := start.Add(20 * time.Second)
+	if err := playSamples(samples, until, time.Second, state, func(s *SignState) bool {
+		s.LogAndPostChan <- *s
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond) // For a tick of the log worker, which goes by the wall clock
+
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines, last := 0, start
+	for scanner := bufio.NewScanner(f); scanner.Scan(); lines++ {
+		logged, err := time.Parse(time.RFC3339Nano, strings.SplitN(scanner.Text(), ",", 2)[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if logged.Before(start) || logged.After(until) {
+			t.Errorf("logged %q, which isn't in the recording", scanner.Text())
+		}
+		if logged.Before(last) {
+			t.Errorf("logged %q after a line at %v", scanner.Text(), last.Format(time.RFC3339Nano))
+		}
+		last = logged
+	}
+	if lines == 0 {
+		t.Errorf("nothing was logged")
+	}
+}
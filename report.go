@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Gaps in the log longer than this are when the sign wasn't running, so they don't count towards anything.
+const maxLogGap = time.Duration(time.Minute)
+
+// logLine is one line of the details log or the activity log. The activity log has fewer columns, so whatever is
+// missing is left as zero.
+type logLine struct {
+	time      time.Time
+	open      bool
+	fault     bool
+	occupancy int
+	onBreak   bool
+}
+
+// daySummary is what report prints for each day.
+type daySummary struct {
+	day                 time.Time
+	open, fault         time.Duration
+	firstOpen, lastShut time.Time
+	timesOpened, breaks int
+	peakOccupancy       int
+}
+
+// report Summarizes the details log a day at a time: how long the studio was open, from when until when, and how
+// busy it got.
+func report(args []string) error {
+	flags := commandFlags("report")
+	logTo := flags.String("log", "", "the log to summarize, the details log next to logFile from the config if empty")
+	days := flags.Int("days", 7, "how many days back to go, including today")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	if *logTo == "" {
+		*logTo = detailLogName(config.LogFile)
+	}
+	f, err := os.Open(*logTo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	since := timeNow().AddDate(0, 0, -*days+1)
+	since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, time.Local)
+	var summaries []*daySummary
+	var prev *logLine
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, err := parseLogLine(scanner.Text())
+		if err != nil {
+			skipped++
+			continue
+		}
+		if line.time.Before(since) {
+			continue
+		}
+		day := time.Date(line.time.Year(), line.time.Month(), line.time.Day(), 0, 0, 0, 0, time.Local)
+		if len(summaries) == 0 || !summaries[len(summaries)-1].day.Equal(day) {
+			summaries = append(summaries, &daySummary{day: day})
+			prev = nil
+		}
+		summary := summaries[len(summaries)-1]
+		if line.open && summary.firstOpen.IsZero() {
+			summary.firstOpen = line.time
+		}
+		if line.occupancy > summary.peakOccupancy {
+			summary.peakOccupancy = line.occupancy
+		}
+		if prev != nil {
+			if gap := line.time.Sub(prev.time); gap > 0 && gap <= maxLogGap {
+				if prev.open {
+					summary.open += gap
+				}
+				if prev.fault {
+					summary.fault += gap
+				}
+			}
+			if line.open && !prev.open {
+				summary.timesOpened++
+			} else if !line.open && prev.open {
+				summary.lastShut = line.time
+			}
+			if line.onBreak && !prev.onBreak {
+				summary.breaks++
+			}
+		} else if line.open {
+			summary.timesOpened++
+		}
+		prev = &line
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Day\tOpen\tFirst open\tLast shut\tTimes opened\tPeak inside\tBreaks\tSensor fault")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+			s.day.Format("Mon Jan 2"),
+			s.open.Round(time.Minute),
+			kitchenOrDash(s.firstOpen),
+			kitchenOrDash(s.lastShut),
+			s.timesOpened,
+			s.peakOccupancy,
+			s.breaks,
+			s.fault.Round(time.Minute),
+		)
+	}
+	w.Flush()
+	if len(summaries) == 0 {
+		fmt.Println("Nothing logged in the last", *days, "days")
+	}
+	if skipped > 0 {
+		fmt.Println("Skipped", skipped, "lines that couldn't be read")
+	}
+	return nil
+}
+
+// parseLogLine Reads a line written by SignState.logAt, to either log.
+func parseLogLine(str string) (line logLine, err error) {
+	columns := strings.Split(strings.TrimSpace(str), ",")
+	if len(columns) < 3 {
+		return line, fmt.Errorf("not enough columns")
+	}
+	if line.time, err = time.Parse(time.RFC3339Nano, columns[0]); err != nil {
+		return line, err
+	}
+	line.time = line.time.Local()
+	if line.open, err = strconv.ParseBool(columns[1]); err != nil {
+		return line, err
+	}
+	if len(columns) > 4 {
+		if line.fault, err = strconv.ParseBool(columns[4]); err != nil {
+			return line, err
+		}
+	}
+	if len(columns) > 5 {
+		if line.occupancy, err = strconv.Atoi(columns[5]); err != nil {
+			return line, err
+		}
+	}
+	if len(columns) > 6 {
+		if line.onBreak, err = strconv.ParseBool(columns[6]); err != nil {
+			return line, err
+		}
+	}
+	return line, nil
+}
+
+func kitchenOrDash(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.Kitchen)
+}
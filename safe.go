@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+	"github.com/veandco/go-sdl2/ttf"
+)
+
+const (
+	safeTitle    = "Sign Down"
+	safeSubtitle = "Please knock to check if the studio is open"
+)
+
+// safeDisplay Shows that the sign is out of order, with nothing else running that could crash it again. supervise
+// falls back to this when the sign keeps crashing. The open sign above the door is turned off, since nobody knows
+// whether the studio is open. An invalid config could be why it keeps crashing, so that doesn't stop it.
+func safeDisplay(args []string) error {
+	flags := commandFlags("safe")
+	if err := parseCommandFlags(flags, args); err != nil {
+		lifecycleLog.Error("Showing the safe display with the default config", "err", err)
+		config = defaultConfig()
+	}
+	relay := openOutputPin(config.Hardware.Relay)
+	if relay.connected() {
+		relay.write(false)
+	}
+	relay.close()
+
+	state := &SignState{}
+	if err := initDisplay(state, sdl.WINDOW_FULLSCREEN|sdl.WINDOW_SHOWN|sdl.WINDOW_BORDERLESS); err != nil {
+		return err
+	}
+	spawnSignalBroadcaster()
+	if !config.Display.Headless {
+		spawnSDLEventWaiter()
+	}
+	for stopReason() == "" {
+		state.Renderer.SetDrawColor(white.R, white.G, white.B, white.A)
+		state.Renderer.Clear()
+		state.blitCentered(studioSize, safeTitle, black, width/2, height/3)
+		state.blitCentered(subtitleSize, safeSubtitle, black, width/2, height*2/3)
+		state.snapshotIfDue()
+		state.Renderer.Present()
+		time.Sleep(config.tick())
+	}
+	waitForWorkers(shutdownTimeout)
+
+	if state.Window != nil {
+		state.Window.Destroy()
+	} else {
+		state.Renderer.Destroy()
+		state.Surface.Free()
+	}
+	for _, font := range state.Fonts {
+		font.Close()
+	}
+	ttf.Quit()
+	sdl.Quit()
+	return nil
+}
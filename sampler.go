@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type inputKind int
+
+const (
+	doorInput inputKind = iota
+	switchInput
+	motionInput
+	faultInput
+	occupancyInput
+	buttonInput
+	overrideInput
+)
+
+func (k inputKind) String() string {
+	switch k {
+	case doorInput:
+		return "door"
+	case switchInput:
+		return "switch"
+	case motionInput:
+		return "motion"
+	case faultInput:
+		return "fault"
+	case occupancyInput:
+		return "occupancy"
+	case buttonInput:
+		return "button"
+	case overrideInput:
+		return "override"
+	}
+	return "unknown"
+}
+
+// inputEvent is sent by the sampler whenever a debounced input changes. Time is when the change was sampled, not
+// when the state machine got around to handling it.
+type inputEvent struct {
+	Time time.Time
+	Kind inputKind
+	// bool for the door and motion, SwitchState for the switch, sensorFaults for faults, +1 or -1 for someone
+	// coming in or going out, *remoteOverride for an override, and nothing for a button press.
+	Value interface{}
+}
+
+const inputEventBacklog = 16
+
+// spawnInputSampler Reads the pins in the background so the state machine only has to deal with changes.
+func spawnInputSampler(si *SignInput) {
+	spawnWorker("input sampler", func(ctx context.Context) {
+		ticker := time.NewTicker(si.samplePeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case now := <-ticker.C:
+				si.sampleOnce(now)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+}
+
+func (si *SignInput) sampleOnce(now time.Time) {
+	sample := si.readSample(now)
+	if si.recorder != nil {
+		si.recorder.record(sample)
+	}
+	si.processSample(sample)
+}
+
+// readSample Reads every input once.
+func (si *SignInput) readSample(now time.Time) inputSample {
+	sample := inputSample{
+		Time:     now,
+		Door:     si.readDoorOpen(now),
+		Switch:   si.readSwitchValue(now),
+		Motion:   si.readMotion(now),
+		Button:   si.readBreakButton(),
+		Override: latestOverride(),
+	}
+	sample.Outer, sample.Inner = si.readBeams()
+	// After the reads, so it includes anything they ran into.
+	sample.Faults = si.sampledFaults()
+	return sample
+}
+
+// processSample Filters a sample and emits events for whatever changed. Samples come from the pins, or from a
+// recording when replaying.
+func (si *SignInput) processSample(sample inputSample) {
+	now := sample.Time
+	door, doorChanged := si.doorFilter.update(sample.Door, now)
+	switchValue, switchChanged := si.switchFilter.update(sample.Switch, now)
+	if doorChanged {
+		si.emit(inputEvent{now, doorInput, door})
+	}
+	if switchChanged {
+		si.emit(inputEvent{now, switchInput, switchValue})
+	}
+	// The PIR sensor already holds its output for a few seconds, so it doesn't need debouncing.
+	if sample.Motion != si.sampledMotion {
+		si.emit(inputEvent{now, motionInput, sample.Motion})
+		si.sampledMotion = sample.Motion
+	}
+	if pressed, changed := si.buttonFilter.update(sample.Button, now); changed && pressed.(bool) {
+		si.emit(inputEvent{now, buttonInput, nil})
+	}
+	if delta := si.beams.update(sample.Outer, sample.Inner, now); delta != 0 {
+		si.emit(inputEvent{now, occupancyInput, delta})
+	}
+	if !sameOverride(sample.Override, si.sampledOverride) {
+		si.emit(inputEvent{now, overrideInput, sample.Override})
+		si.sampledOverride = sample.Override
+	}
+	if faults := sample.Faults.String(); faults != si.lastSampledFaults {
+		si.emit(inputEvent{now, faultInput, sample.Faults})
+		si.lastSampledFaults = faults
+	}
+
+	diagnosticsLock.Lock()
+	diagnostics.Time = now
+	diagnostics.RawDoorOpen, diagnostics.DoorOpen = sample.Door, door.(bool)
+	diagnostics.RawSwitchValue, diagnostics.SwitchValue = sample.Switch, switchValue.(SwitchState)
+	diagnostics.Motion = sample.Motion
+	diagnosticsLock.Unlock()
+}
+
+// emit Waits for room in the backlog rather than dropping the event, since the filters have already moved on and
+// the state machine would be out of step with them until the next change.
+func (si *SignInput) emit(e inputEvent) {
+	select {
+	case si.events <- e:
+	case <-rootContext.Done():
+		// The state machine has stopped reading because we're shutting down.
+	}
+}
+
+// applyEvents Catches the state machine up on everything the sampler has seen since the last tick.
+func (si *SignInput) applyEvents(now time.Time) {
+	for {
+		select {
+		case e := <-si.events:
+			switch e.Kind {
+			case doorInput:
+				si.doorOpen, si.doorChangedAt = e.Value.(bool), e.Time
+			case switchInput:
+				si.switchValue = e.Value.(SwitchState)
+			case motionInput:
+				// Motion either just started or was seen right up until now.
+				si.motion, si.lastMotion = e.Value.(bool), e.Time
+			case faultInput:
+				si.faults = e.Value.(sensorFaults)
+			case occupancyInput:
+				si.countOccupant(e.Value.(int), e.Time)
+			case buttonInput:
+				si.toggleBreak(e.Time)
+			case overrideInput:
+				si.overrideSet = e.Value.(*remoteOverride)
+			}
+			si.updateOpen(e.Time)
+		default:
+			// The shifts change with time even if nothing else does.
+			si.updateOpen(now)
+			if si.motion {
+				si.lastMotion = now
+			}
+			si.resetOccupancyDaily(now)
+			si.saveState(now, false)
+			diagnosticsLock.Lock()
+			diagnostics.LastMotion, diagnostics.Occupied = si.lastMotion, si.IsOccupied(now)
+			diagnostics.Faults = si.Faults(now)
+			diagnostics.Occupancy = si.occupancy
+			diagnosticsLock.Unlock()
+			return
+		}
+	}
+}
+
+func (si *SignInput) updateOpen(t time.Time) {
+	si.expireBreak(t)
+	si.override = si.overrideSet.activeAt(t)
+	if si.switchValue == stateClosedForced || si.switchValue.customMode() != nil || si.OnBreak(t) {
+		si.override = nil
+	}
+	si.rawOpen = computeOpen(len(shifts.getShiftsAtTime(t)) > 0, si.doorOpen, si.switchValue, si.OnBreak(t), si.override)
+	if open := si.openFilter.update(si.rawOpen, t); open != si.open || si.openChangedAt.IsZero() {
+		si.open, si.openChangedAt = open, t
+	}
+
+	diagnosticsLock.Lock()
+	diagnostics.RawOpen, diagnostics.Open = si.rawOpen, si.open
+	diagnosticsLock.Unlock()
+}
+
+// inputDiagnostics is a snapshot of the raw and filtered inputs, served at /debug/inputs.
+type inputDiagnostics struct {
+	Time           time.Time
+	RawDoorOpen    bool
+	DoorOpen       bool
+	RawSwitchValue SwitchState
+	SwitchValue    SwitchState
+	RawOpen        bool
+	Open           bool
+	Motion         bool
+	LastMotion     time.Time
+	Occupied       bool
+	Faults         sensorFaults
+	Occupancy      int
+}
+
+var diagnostics inputDiagnostics
+var diagnosticsLock sync.Mutex
+
+func serveInputDiagnostics(w http.ResponseWriter, r *http.Request) {
+	diagnosticsLock.Lock()
+	diag := diagnostics
+	diagnosticsLock.Unlock()
+	if diag.Time.IsZero() {
+		http.Error(w, "inputs have not been sampled yet", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(diag)
+}
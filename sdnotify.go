@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// heartbeatEnv is set by supervise to the file descriptor the sign writes its heartbeat to.
+const heartbeatEnv = "SIGN_HEARTBEAT_FD"
+
+// How long the state machine can go without a tick before the sign stops sending its heartbeat.
+const heartbeatStale = time.Duration(5 * time.Second)
+
+// lastTick is when the state machine last ran, in Unix nanoseconds.
+var lastTick atomic.Int64
+
+// sdNotify Tells systemd about the sign, e.g. "READY=1", if it's running as a Type=notify service.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' { // Abstract socket
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval How often systemd wants to hear "WATCHDOG=1", or 0 if it doesn't.
+func watchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// spawnHeartbeat Lets whatever is looking after the sign know it's still working, as long as the state machine is
+// ticking: supervise through the pipe it gave us, or systemd's watchdog when the sign is run as a service of its own.
+func spawnHeartbeat() {
+	period := time.Duration(time.Second)
+	var beat func(first bool)
+	if fd, err := strconv.Atoi(os.Getenv(heartbeatEnv)); err == nil {
+		pipe := os.NewFile(uintptr(fd), "heartbeat")
+		beat = func(first bool) {
+			pipe.Write([]byte("\n"))
+		}
+	} else if os.Getenv("NOTIFY_SOCKET") != "" {
+		if interval := watchdogInterval(); interval > 0 && interval/2 < period {
+			period = interval / 2
+		}
+		beat = func(first bool) {
+			if first {
+				sdNotify("READY=1")
+			}
+			if watchdogInterval() > 0 {
+				sdNotify("WATCHDOG=1")
+			}
+		}
+	} else {
+		return
+	}
+	spawnWorker("heartbeat", func(ctx context.Context) {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		first := true
+		for {
+			select {
+			case <-ticker.C:
+				if time.Since(time.Unix(0, lastTick.Load())) < heartbeatStale {
+					beat(first)
+					first = false
+				}
+			case <-ctx.Done():
+				sdNotify("STOPPING=1")
+				return
+			}
+		}
+	})
+}
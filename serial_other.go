@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"io"
+	"os"
+)
+
+// openSerial Opens a serial port as is, so it has to be set up beforehand with something like
+// `stty -f /dev/cu.usbmodem1411 9600 raw`.
+func openSerial(device string, baud int) (io.ReadWriteCloser, error) {
+	return os.OpenFile(device, os.O_RDWR, 0)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// How long a scripted button press is held down, long enough to get past the debouncing.
+const simulatedPressLength = 2 * defaultButtonBounce
+
+// simulate Plays a script of inputs through the sign, with no pins, and prints what it says each time that changes.
+// It's for checking what the sign will do for a day's (or a week's) shifts without waiting for them. With -window it
+// shows the sign speeding through it, and with -contact it saves a picture of the sign at each change.
+func simulate(args []string) error {
+	flags := commandFlags("simulate")
+	start := flags.String("start", "", "when the script starts, like 2019-02-12T09:00:00-06:00, now if empty")
+	length := flags.Duration("for", 0, "how long to simulate, like 168h for a week, instead of the script's end")
+	window := flags.Bool("window", false, "show the sign in a window as it goes")
+	speed := flags.Float64("speed", 600, "how many times faster than real time the window plays")
+	step := flags.Duration("step", 0, "how far the clock moves each tick, a real tick if 0 (or -speed ticks with -window)")
+	contact := flags.String("contact", "", "save a contact sheet PNG with a picture of the sign at each change")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	startTime := time.Now()
+	if *start != "" {
+		var err error
+		if startTime, err = time.Parse(time.RFC3339, *start); err != nil {
+			return fmt.Errorf("start: %v", err)
+		}
+		startTime = startTime.Local() // The shifts are in local time
+	}
+	script, name := os.Stdin, "stdin"
+	if flags.NArg() > 0 {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		script, name = f, flags.Arg(0)
+	}
+	samples, end, err := readSimulateScript(script, name, startTime)
+	if err != nil {
+		return err
+	}
+	if *length > 0 {
+		end = startTime.Add(*length)
+	}
+	if *window && *speed <= 0 {
+		return fmt.Errorf("speed has to be more than 0")
+	}
+	if *step <= 0 {
+		*step = config.tick()
+		if *window {
+			*step = time.Duration(float64(config.tick()) * *speed)
+		}
+	}
+
+	inputState.setup(config)
+	signTransitionListeners = nil // The reasons are printed below, with the time
+	state := &SignState{Init: true}
+	var sheet *contactSheet
+	if *window || *contact != "" {
+		if !*window {
+			config.Display.Headless = true
+		}
+		config.Display.SnapshotFile = ""
+		if err := initDisplay(state, sdl.WINDOW_SHOWN); err != nil {
+			return err
+		}
+		spawnSignalBroadcaster()
+		if !config.Display.Headless {
+			spawnSDLEventWaiter()
+		}
+		if *contact != "" {
+			sheet = &contactSheet{}
+		}
+	}
+	var last SignState
+	err = playSamples(samples, end, *step, state, func(s *SignState) bool {
+		changed := s.Phase != last.Phase || s.Title != last.Title || s.Subtitle != last.Subtitle
+		if changed {
+			fmt.Printf("%v  %-14v %v", timeNow().Format("Mon 3:04:05PM"), s.Phase, s.Title)
+			if s.Subtitle != "" {
+				fmt.Printf(" / %v", s.Subtitle)
+			}
+			if s.Phase != last.Phase {
+				fmt.Printf(" (%v)", s.LastTransition.Reason)
+			}
+			fmt.Println()
+			last = *s
+		}
+		if s.Renderer == nil {
+			return true
+		}
+		if *window || changed {
+			s.compose()
+			if sheet != nil && changed {
+				if err := sheet.add(s); err != nil {
+					displayLog.Error("Failed to add to the contact sheet", "err", err)
+				}
+			}
+			s.Renderer.Present()
+		}
+		if *window {
+			time.Sleep(config.tick())
+		}
+		return stopReason() == ""
+	})
+	if sheet != nil {
+		if err := sheet.write(*contact); err != nil {
+			return err
+		}
+		fmt.Println("Saved", len(sheet.frames), "pictures to", *contact)
+	}
+	if state.Renderer != nil {
+		stopSign("end of simulation")
+		if _, cleanupErr := transitionFunction(state, inputFunction()); err == nil {
+			err = cleanupErr
+		}
+	}
+	return err
+}
+
+// readSimulateScript Turns a script into samples. Each line is "<time since the start> <input> <value>", e.g.
+// "90m door open", in order:
+//
+//	door open|closed
+//	switch shifts|open|closed|<custom mode>
+//	motion on|off
+//	button press
+//	end
+//
+// The inputs start with the door closed, the switch on shifts and no motion. Without an end line, the simulation
+// runs for a minute after the last one.
+func readSimulateScript(r io.Reader, name string, start time.Time) ([]inputSample, time.Time, error) {
+	current := inputSample{Time: start, Switch: stateShifts}
+	samples := []inputSample{current}
+	last, end := start, time.Time{}
+	var releaseAt time.Time // When a button press is let go, if it's held
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		fail := func(format string, a ...interface{}) error {
+			return fmt.Errorf("%v:%v: %v", name, line, fmt.Sprintf(format, a...))
+		}
+		offset, err := time.ParseDuration(fields[0])
+		if err != nil {
+			return nil, end, fail("should start with a time like 90m")
+		}
+		t := start.Add(offset)
+		if t.Before(last) {
+			return nil, end, fail("goes back in time")
+		}
+		last = t
+		if !releaseAt.IsZero() && !t.Before(releaseAt) {
+			current.Time, current.Button, releaseAt = releaseAt, false, time.Time{}
+			samples = append(samples, current)
+		}
+		if len(fields) == 2 && fields[1] == "end" {
+			end = t
+			break
+		}
+		if len(fields) != 3 {
+			return nil, end, fail("should be <time> <input> <value>")
+		}
+		current.Time = t
+		switch input, value := fields[1], fields[2]; {
+		case input == "door" && (value == "open" || value == "closed"):
+			current.Door = value == "open"
+		case input == "switch":
+			sv, ok := switchStateByName(value)
+			if !ok {
+				return nil, end, fail("switch should be shifts, open, closed or one of the modes in the config")
+			}
+			current.Switch = sv
+		case input == "motion" && (value == "on" || value == "off"):
+			current.Motion = value == "on"
+		case input == "button" && value == "press":
+			current.Button, releaseAt = true, t.Add(simulatedPressLength)
+		default:
+			return nil, end, fail("don't know %v %v", input, value)
+		}
+		samples = append(samples, current)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, end, err
+	}
+	if !releaseAt.IsZero() {
+		current.Time, current.Button = releaseAt, false
+		samples = append(samples, current)
+	}
+	if end.IsZero() {
+		end = samples[len(samples)-1].Time.Add(time.Minute)
+	}
+	return samples, end, nil
+}
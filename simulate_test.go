@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// describeSamples One line per sample, with the time as an offset from start, so they're easy to compare.
+func describeSamples(samples []inputSample, start time.Time) []string {
+	var lines []string
+	for _, s := range samples {
+		lines = append(lines, fmt.Sprintf("%v door=%v switch=%v motion=%v button=%v", s.Time.Sub(start), s.Door, s.Switch, s.Motion, s.Button))
+	}
+	return lines
+}
+
+func TestReadSimulateScript(t *testing.T) {
+	start := time.Date(2019, 2, 12, 12, 0, 0, 0, time.Local)
+	for _, test := range []struct {
+		name        string
+		script      string
+		wantSamples []string
+		wantEnd     time.Duration
+		wantErr     string
+	}{
+		{
+			name:   "inputs in order",
+			script: "# A comment\n\n10m door open\n20m switch open\n30m motion on\n1h end\n",
+			wantSamples: []string{
+				fmt.Sprintf("0s door=false switch=%v motion=false button=false", stateShifts),
+				fmt.Sprintf("10m0s door=true switch=%v motion=false button=false", stateShifts),
+				fmt.Sprintf("20m0s door=true switch=%v motion=false button=false", stateOpenForced),
+				fmt.Sprintf("30m0s door=true switch=%v motion=true button=false", stateOpenForced),
+			},
+			wantEnd: time.Hour,
+		},
+		{
+			name:   "a press is let go without undoing what came after",
+			script: "10m button press\n10m door open\n",
+			wantSamples: []string{
+				fmt.Sprintf("0s door=false switch=%v motion=false button=false", stateShifts),
+				fmt.Sprintf("10m0s door=false switch=%v motion=false button=true", stateShifts),
+				fmt.Sprintf("10m0s door=true switch=%v motion=false button=true", stateShifts), // Still held
+				fmt.Sprintf("%v door=true switch=%v motion=false button=false", 10*time.Minute+simulatedPressLength, stateShifts),
+			},
+			wantEnd: 11*time.Minute + simulatedPressLength,
+		},
+		{
+			name:   "a press is let go before the next line",
+			script: "10m button press\n20m door open\n",
+			wantSamples: []string{
+				fmt.Sprintf("0s door=false switch=%v motion=false button=false", stateShifts),
+				fmt.Sprintf("10m0s door=false switch=%v motion=false button=true", stateShifts),
+				fmt.Sprintf("%v door=false switch=%v motion=false button=false", 10*time.Minute+simulatedPressLength, stateShifts),
+				fmt.Sprintf("20m0s door=true switch=%v motion=false button=false", stateShifts),
+			},
+			wantEnd: 21 * time.Minute,
+		},
+		{
+			name:   "ends a minute after the last input",
+			script: "90m door open",
+			wantSamples: []string{
+				fmt.Sprintf("0s door=false switch=%v motion=false button=false", stateShifts),
+				fmt.Sprintf("1h30m0s door=true switch=%v motion=false button=false", stateShifts),
+			},
+			wantEnd: 91 * time.Minute,
+		},
+		{name: "no time", script: "door open", wantErr: "test:1: should start with a time like 90m"},
+		{name: "back in time", script: "10m door open\n# 5m\n5m door closed", wantErr: "test:3: goes back in time"},
+		{name: "missing value", script: "10m door", wantErr: "test:1: should be <time> <input> <value>"},
+		{name: "unknown input", script: "10m window open", wantErr: "test:1: don't know window open"},
+		{name: "unknown value", script: "10m door ajar", wantErr: "test:1: don't know door ajar"},
+		{name: "unknown mode", script: "10m switch party", wantErr: "test:1: switch should be"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			samples, end, err := readSimulateScript(strings.NewReader(test.script), "test", start)
+			if test.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := describeSamples(samples, start); !equalStrings(got, test.wantSamples) {
+				t.Errorf("got samples\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(test.wantSamples, "\n"))
+			}
+			if !end.Equal(start.Add(test.wantEnd)) {
+				t.Errorf("ends at %v, want %v", end.Sub(start), test.wantEnd)
+			}
+		})
+	}
+}
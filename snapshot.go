@@ -0,0 +1,64 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"io"
+	"unsafe"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// initHeadless Draws the sign on a surface in memory with the software renderer, so it runs without a display. What
+// it looks like can still be seen in the snapshots.
+func initHeadless(s *SignState) error {
+	surface, err := sdl.CreateRGBSurfaceWithFormat(0, width, height, 32, sdl.PIXELFORMAT_ABGR8888)
+	if err != nil {
+		return err
+	}
+	renderer, err := sdl.CreateSoftwareRenderer(surface)
+	if err != nil {
+		surface.Free()
+		return err
+	}
+	s.Surface, s.Renderer = surface, renderer
+	return nil
+}
+
+// snapshot Copies what has been drawn so far this frame. It has to be called before the frame is presented, after
+// that what the renderer has is undefined, so see compose.
+func (s *SignState) snapshot() (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	// ABGR8888 is R, G, B, A in memory on the Pi, the same as image.RGBA.
+	if err := s.Renderer.ReadPixels(nil, sdl.PIXELFORMAT_ABGR8888, unsafe.Pointer(&img.Pix[0]), img.Stride); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// snapshotIfDue Writes the frame to display.snapshotFile if it's been display.snapshotPeriod since the last one.
+func (s *SignState) snapshotIfDue() {
+	if config.Display.SnapshotFile == "" {
+		return
+	}
+	now := timeNow()
+	if !s.LastSnapshot.IsZero() && now.Sub(s.LastSnapshot) < duration(config.Display.SnapshotPeriod) {
+		return
+	}
+	s.LastSnapshot = now
+	if err := s.writeSnapshot(config.Display.SnapshotFile); err != nil {
+		displayLog.Error("Failed to write snapshot", "file", config.Display.SnapshotFile, "err", err)
+	}
+}
+
+// writeSnapshot Saves the frame as a PNG. It's replaced in one go, so anything watching the file never sees half a
+// picture.
+func (s *SignState) writeSnapshot(filename string) error {
+	img, err := s.snapshot()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(filename, func(w io.Writer) error {
+		return png.Encode(w, img)
+	})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// statusVersion is the version of statusPayload. It only goes up when a field is taken away or changes meaning, new
+// fields can be added without it. The legacy payload counts as version 1.
+const statusVersion = 2
+
+// statusPayload is what's posted to post.url with the "v2" post.format. Times are RFC 3339 and left out when there
+// isn't one.
+type statusPayload struct {
+	Version       int             `json:"version"`
+	Time          time.Time       `json:"time"`
+	Open          bool            `json:"open"`
+	DoorOpen      bool            `json:"doorOpen"`
+	Switch        string          `json:"switch"` // shifts, open, closed or the name of a custom mode
+	State         string          `json:"state"`  // The phase, like OpenShift or ClosingSoon
+	Reason        string          `json:"reason"` // Why it's in that state
+	Title         string          `json:"title"`  // What the sign says
+	Subtitle      string          `json:"subtitle"`
+	Background    statusColor     `json:"background"`
+	MentorsOnDuty []string        `json:"mentorsOnDuty"`
+	NextOpening   *time.Time      `json:"nextOpening,omitempty"` // When the next shift today starts, if it's closed
+	ClosesAt      *time.Time      `json:"closesAt,omitempty"`
+	BreakUntil    *time.Time      `json:"breakUntil,omitempty"`
+	Override      *remoteOverride `json:"override,omitempty"`
+	Motion        bool            `json:"motion"`
+	LastMotion    *time.Time      `json:"lastMotion,omitempty"`
+	Occupied      bool            `json:"occupied"`
+	Occupancy     int             `json:"occupancy"`
+	Capacity      int             `json:"capacity"`
+	Faults        []string        `json:"faults"`
+}
+
+type statusColor struct {
+	R uint8 `json:"r"`
+	G uint8 `json:"g"`
+	B uint8 `json:"b"`
+}
+
+// legacyStatusPayload is what was always posted, for the "legacy" post.format. The subtitle has the words the sign
+// shows next to it added on, e.g. "Mentor on Duty: " or "Should Open At: ".
+// Anything new only goes in v2.
+type legacyStatusPayload struct {
+	BgColor  string `json:"bgColor"` // Like "rgb(0,95,77)"
+	Title    string `json:"title"`
+	Subtitle string `json:"subtitle"`
+}
+
+// statusPayload What to post for the state at now, in the format from the config.
+func (s *SignState) statusPayload(now time.Time) interface{} {
+	if config.Post.Format == "v2" {
+		return s.versionedStatus(now)
+	}
+	return s.legacyStatus()
+}
+
+func (s *SignState) versionedStatus(now time.Time) statusPayload {
+	p := statusPayload{
+		Version:       statusVersion,
+		Time:          now,
+		Open:          s.Open,
+		DoorOpen:      s.DoorOpen,
+		Switch:        s.SwitchValue.name(),
+		State:         s.Phase.String(),
+		Reason:        s.LastTransition.Reason,
+		Title:         s.Title,
+		Subtitle:      s.Subtitle,
+		Background:    statusColor{s.BackgroundFill.R, s.BackgroundFill.G, s.BackgroundFill.B},
+		MentorsOnDuty: []string{},
+		ClosesAt:      timeOrNil(s.ClosesAt),
+		BreakUntil:    timeOrNil(s.BreakUntil),
+		Override:      s.Override,
+		Motion:        s.Motion,
+		LastMotion:    timeOrNil(s.LastMotion),
+		Occupied:      s.Occupied,
+		Occupancy:     s.Occupancy,
+		Capacity:      s.Capacity,
+		Faults:        s.faultStrings(),
+	}
+	for _, shift := range shifts.getShiftsAtTime(now) {
+		p.MentorsOnDuty = append(p.MentorsOnDuty, shift.name)
+	}
+	if !s.Open {
+		if next := shifts.getShiftsAfterTime(now); len(next) > 0 {
+			p.NextOpening = timeOrNil(next[0].time(now.Date()))
+		}
+	}
+	return p
+}
+
+func (s *SignState) legacyStatus() legacyStatusPayload {
+	return legacyStatusPayload{
+		BgColor:  fmt.Sprintf("rgb(%v,%v,%v)", s.BackgroundFill.R, s.BackgroundFill.G, s.BackgroundFill.B),
+		Title:    s.Title,
+		Subtitle: s.legacySubtitle(),
+	}
+}
+
+// legacySubtitle The subtitle with the words that go with it on the sign.
+func (s *SignState) legacySubtitle() string {
+	// With a remote override, the subtitle already says why and until when. When full, it says to wait, and custom
+	// modes have their own.
+	if s.Subtitle != "" && s.Override == nil && !s.Full && s.Mode == nil && !s.onBreak() && s.Phase != phaseClosingSoon {
+		if !s.Open && s.SwitchValue == stateShifts { // When it opens
+			if _, err := time.Parse(time.Kitchen, s.Subtitle); err != nil { // "?", nobody knows
+				return ""
+			}
+			return whetherOpensOpenAt + s.Subtitle
+		}
+		return makePluralHandlingMentorString(s.Subtitle, false) + s.Subtitle
+	}
+	if !s.Open && s.SwitchValue == stateShifts && s.Override == nil && !s.onBreak() {
+		return whetherOpensNotOpen
+	}
+	return s.Subtitle
+}
+
+func (s *SignState) faultStrings() []string {
+	faults := make([]string, len(s.Faults))
+	for i, fault := range s.Faults {
+		faults[i] = fault.String()
+	}
+	return faults
+}
+
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLegacyStatusKeepsItsShape(t *testing.T) {
+	saved := config
+	t.Cleanup(func() { config = saved })
+	config.Post.Format = "legacy"
+	s := &SignState{Title: "Open", Subtitle: "Joey H", Open: true, SwitchValue: stateShifts, Phase: phaseOpenShift,
+		BackgroundFill: green, Motion: true, Occupancy: 3}
+	content, err := json.Marshal(s.statusPayload(timeNow()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]string
+	if err := json.Unmarshal(content, &got); err != nil {
+		t.Fatalf("%s: %v", content, err)
+	}
+	want := map[string]string{"bgColor": "rgb(0,95,77)", "title": "Open", "subtitle": "Mentor: Joey H"}
+	if len(got) != len(want) {
+		t.Errorf("posted %s, want only %v", content, want)
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%v is %q, want %q", key, got[key], value)
+		}
+	}
+}
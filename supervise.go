@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	minRestartBackoff = time.Duration(1 * time.Second)
+	// After running this long without crashing, the sign goes back to being restarted straight away.
+	stableRunTime = time.Duration(10 * time.Minute)
+	// How many crash reports are kept. The oldest are deleted first.
+	maxCrashReports = 50
+)
+
+// supervise Runs the sign in a process of its own and restarts it when it crashes or hangs, waiting longer each time
+// it crashes in a row. What it printed before crashing, which includes the stack trace of a panic, goes in a crash
+// report. If it keeps crashing, the safe display is shown for a while before trying again.
+func supervise(args []string) error {
+	flags := commandFlags("supervise")
+	if err := parseCommandFlags(flags, args); err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	sc := config.Supervisor
+	spawnSignalBroadcaster()
+	spawnWatchdog()
+	defer waitForWorkers(shutdownTimeout)
+	defer stopSign("supervisor stopped")
+
+	// The sign gets the same -config and -set, but logs to the console whatever the config says, so its logs end up
+	// in the crash reports. The supervisor passes them on to wherever its own output goes.
+	childArgs := append(append([]string(nil), args...), "-set", "logging.output=console")
+	signArgs, safeArgs := append([]string{"run"}, childArgs...), append([]string{"safe"}, childArgs...)
+	// Ready as soon as the supervisor is, since it's the one systemd needs to hear from. Waiting for the sign would
+	// get the supervisor killed at the start timeout if the sign crashes before it's up, and then the safe display
+	// would never be shown.
+	sdNotify("READY=1")
+	backoff := minRestartBackoff
+	var crashes []time.Time
+	for rootContext.Err() == nil {
+		started := time.Now()
+		sdNotify("STATUS=Running the sign")
+		child := &signProcess{output: newOutputTail(sc.CrashLines)}
+		err := child.run(executable, signArgs, duration(sc.HangTimeout), time.Time{})
+		if rootContext.Err() != nil {
+			break
+		}
+		if err == nil {
+			supervisorLog.Info("The sign exited by itself, not restarting it")
+			return nil
+		}
+
+		ended := time.Now()
+		supervisorLog.Error("The sign crashed", "err", err, "ran", ended.Sub(started).Round(time.Second))
+		if report, err := writeCrashReport(sc.CrashDir, started, ended, err, child.output.lines()); err != nil {
+			supervisorLog.Error("Failed to write the crash report", "err", err)
+		} else {
+			supervisorLog.Info("Wrote the crash report", "file", report)
+		}
+		if ended.Sub(started) > stableRunTime {
+			backoff = minRestartBackoff
+		}
+		crashes = append(crashes, ended)
+		for len(crashes) > 0 && ended.Sub(crashes[0]) > duration(sc.CrashLoopWindow) {
+			crashes = crashes[1:]
+		}
+
+		if len(crashes) >= sc.CrashLoop {
+			until := time.Now().Add(duration(sc.SafeModeTime))
+			supervisorLog.Error("The sign is crash looping, showing the safe display", "crashes", len(crashes), "until", until.Format(time.Kitchen))
+			sdNotify(fmt.Sprintf("STATUS=Crashed %v times, showing the safe display until %v", len(crashes), until.Format(time.Kitchen)))
+			safe := &signProcess{output: newOutputTail(sc.CrashLines)}
+			if err := safe.run(executable, safeArgs, 0, until); err != nil {
+				supervisorLog.Error("The safe display failed", "err", err)
+			}
+			sleepUntil(until)
+			crashes, backoff = nil, minRestartBackoff
+			continue
+		}
+
+		supervisorLog.Info("Restarting the sign", "in", backoff)
+		sdNotify(fmt.Sprintf("STATUS=Crashed, restarting in %v", backoff))
+		sleepUntil(time.Now().Add(backoff))
+		if backoff *= 2; backoff > duration(sc.MaxBackoff) {
+			backoff = duration(sc.MaxBackoff)
+		}
+	}
+	supervisorLog.Info("Stopped", "reason", stopReason())
+	return nil
+}
+
+// sleepUntil Sleeps until t, or until the supervisor is told to stop.
+func sleepUntil(t time.Time) {
+	select {
+	case <-time.After(time.Until(t)):
+	case <-rootContext.Done():
+	}
+}
+
+// spawnWatchdog Tells systemd's watchdog the supervisor is still going, if it wants to know. The supervisor keeps an
+// eye on the sign itself, so this carries on while the sign is being restarted.
+func spawnWatchdog() {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return
+	}
+	spawnWorker("watchdog", func(ctx context.Context) {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sdNotify("WATCHDOG=1")
+			case <-ctx.Done():
+				sdNotify("STOPPING=1")
+				return
+			}
+		}
+	})
+}
+
+// signProcess is one run of the sign (or the safe display) by the supervisor.
+type signProcess struct {
+	output        *outputTail
+	lastHeartbeat atomic.Int64 // Unix nanoseconds, 0 before the first one
+}
+
+// run Runs the sign until it exits. It's killed if it goes hangTimeout without a heartbeat, counting from when it
+// started, unless that's 0, and stopped if it's still going at until, unless that's zero. It returns nil if the sign
+// exited cleanly or was stopped.
+func (p *signProcess) run(executable string, args []string, hangTimeout time.Duration, until time.Time) error {
+	heartbeats, heartbeatWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer heartbeats.Close()
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(childEnvironment(), fmt.Sprintf("%v=3", heartbeatEnv))
+	cmd.ExtraFiles = []*os.File{heartbeatWriter} // fd 3
+	cmd.Stdout, cmd.Stderr = p.output.writer(os.Stdout), p.output.writer(os.Stderr)
+	err = cmd.Start()
+	heartbeatWriter.Close()
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	go func() {
+		scanner := bufio.NewScanner(heartbeats)
+		for scanner.Scan() {
+			p.lastHeartbeat.Store(time.Now().UnixNano())
+		}
+	}()
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	// Asks it to shut down like Ctrl-C would, and kills it if it hasn't after a while
+	stop := func() {
+		cmd.Process.Signal(os.Interrupt)
+		time.AfterFunc(2*shutdownTimeout, func() {
+			cmd.Process.Kill()
+		})
+	}
+
+	check := time.NewTicker(time.Second)
+	defer check.Stop()
+	done := rootContext.Done()
+	var stopped bool
+	var hung error
+	for {
+		select {
+		case err := <-exited:
+			if hung != nil {
+				return hung
+			}
+			if stopped {
+				return nil
+			}
+			return err
+		case <-done:
+			done = nil
+			if !stopped {
+				stopped = true
+				stop()
+			}
+		case now := <-check.C:
+			if !until.IsZero() && now.After(until) && !stopped {
+				stopped = true
+				stop()
+			}
+			// Until the first heartbeat, it gets as long to start up as it would between heartbeats
+			last := started
+			if beat := time.Unix(0, p.lastHeartbeat.Load()); beat.After(last) {
+				last = beat
+			}
+			if hangTimeout > 0 && now.Sub(last) > hangTimeout && hung == nil {
+				hung = fmt.Errorf("no heartbeat for %v", hangTimeout)
+				// SIGABRT makes Go print every goroutine's stack on the way out, for the crash report
+				cmd.Process.Signal(syscall.SIGABRT)
+				time.AfterFunc(shutdownTimeout, func() {
+					cmd.Process.Kill()
+				})
+			}
+		}
+	}
+}
+
+// childEnvironment The environment for the sign, without systemd's variables, since the supervisor talks to systemd.
+func childEnvironment() []string {
+	var env []string
+	for _, v := range os.Environ() {
+		name := strings.SplitN(v, "=", 2)[0]
+		if name != "NOTIFY_SOCKET" && name != "WATCHDOG_USEC" && name != "WATCHDOG_PID" && name != heartbeatEnv {
+			env = append(env, v)
+		}
+	}
+	return env
+}
+
+// outputTail passes on what the sign prints and remembers the last lines of it for crash reports.
+type outputTail struct {
+	mutex sync.Mutex
+	max   int
+	tail  []string
+}
+
+func newOutputTail(max int) *outputTail {
+	return &outputTail{max: max}
+}
+
+func (t *outputTail) add(line string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.tail = append(t.tail, line)
+	if len(t.tail) > t.max {
+		t.tail = t.tail[len(t.tail)-t.max:]
+	}
+}
+
+func (t *outputTail) lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.tail...)
+}
+
+// writer Passes output on to out, keeping the lines. stdout and stderr each get one, so their partial lines don't
+// get mixed up.
+func (t *outputTail) writer(out io.Writer) io.Writer {
+	return &tailWriter{tail: t, out: out}
+}
+
+type tailWriter struct {
+	tail    *outputTail
+	out     io.Writer
+	partial string
+}
+
+func (w *tailWriter) Write(p []byte) (int, error) {
+	w.out.Write(p)
+	lines := strings.Split(w.partial+string(p), "\n")
+	for _, line := range lines[:len(lines)-1] {
+		w.tail.add(line)
+	}
+	w.partial = lines[len(lines)-1]
+	return len(p), nil
+}
+
+// writeCrashReport Writes what's known about a crash to a new file in dir, and deletes the oldest reports past
+// maxCrashReports.
+func writeCrashReport(dir string, started, ended time.Time, cause error, lines []string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	filename := filepath.Join(dir, "crash-"+ended.Format("20060102-150405")+".log")
+	var report strings.Builder
+	fmt.Fprintln(&report, "Crashed:", ended.Format(time.RFC3339))
+	fmt.Fprintln(&report, "Started:", started.Format(time.RFC3339))
+	fmt.Fprintln(&report, "Ran for:", ended.Sub(started).Round(time.Second))
+	fmt.Fprintln(&report, "Cause:", cause)
+	fmt.Fprintf(&report, "\nLast %v lines of output:\n", len(lines))
+	for _, line := range lines {
+		fmt.Fprintln(&report, line)
+	}
+	if err := os.WriteFile(filename, []byte(report.String()), 0644); err != nil {
+		return "", err
+	}
+
+	reports, err := filepath.Glob(filepath.Join(dir, "crash-*.log"))
+	if err != nil {
+		return filename, err
+	}
+	sort.Strings(reports) // Oldest first, from the names
+	for len(reports) > maxCrashReports {
+		os.Remove(reports[0])
+		reports = reports[1:]
+	}
+	return filename, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunHangTimeout(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"hangs before its first heartbeat", "exec sleep 30", "no heartbeat for 1s"},
+		{"stops sending heartbeats", "echo >&3; exec sleep 30", "no heartbeat for 1s"},
+		{"keeps sending heartbeats", "while true; do echo >&3; sleep 0.2; done", ""}, // Until it's stopped
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			p := &signProcess{output: newOutputTail(10)}
+			err := p.run("/bin/sh", []string{"-c", test.script}, time.Second, time.Now().Add(3*time.Second))
+			if test.wantErr == "" && err != nil {
+				t.Errorf("got %v, want it to be stopped cleanly", err)
+			} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Errorf("got %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -1,5 +1,6 @@
 #!/bin/bash
-# Bash script to keep the studio status program running, even in the event of crashes.
+# Bash script to update the studio status program and start it. It's kept running by the supervisor, which restarts it
+# if it crashes and writes what happened to crashes/.
 cd $HOME/go/src/github.com/vanderbilt-design-studio/studio_status_go
 export GOPATH=$HOME/go
 git pull
@@ -8,7 +9,4 @@ cp activity.log /tmp/activity.log
 sed -i -e's|[^[:print:]]||g' /tmp/activity.log
 cp /tmp/activity.log activity.log
 
-while :
-do
-	./studio_status_go 2>>crashes.log || date >> crashes.log
-done
+exec ./studio_status_go supervise 2>>crashes.log